@@ -0,0 +1,270 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+	"github.com/bitrise-steplib/steps-git-clone/gitclone"
+	"gopkg.in/yaml.v2"
+)
+
+// stepYML is the Step definition, its inputs are the CLI flags and their default values
+//
+//go:embed step.yml
+var stepYML []byte
+
+const checkoutCommand = "checkout"
+
+// flagAliases are the short forms of the most frequently used inputs
+var flagAliases = map[string]string{
+	"repo":            "repository_url",
+	"dir":             "clone_into_dir",
+	"pr-id":           "pull_request_id",
+	"pr-repo":         "pull_request_repository_url",
+	"pr-dest":         "branch_dest",
+	"pr-merge-branch": "pull_request_merge_branch",
+	"pr-head-branch":  "pull_request_head_branch",
+	"depth":           "clone_depth",
+}
+
+type stepInput struct {
+	name         string
+	defaultValue string
+	summary      string
+}
+
+// parseStepInputs returns the inputs of the Step definition in their declaration order
+func parseStepInputs(stepDefinition []byte) ([]stepInput, error) {
+	var definition struct {
+		Inputs []yaml.MapSlice `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal(stepDefinition, &definition); err != nil {
+		return nil, fmt.Errorf("parsing step definition failed: %v", err)
+	}
+
+	var inputs []stepInput
+	for _, item := range definition.Inputs {
+		input := stepInput{}
+		for _, field := range item {
+			key := fmt.Sprint(field.Key)
+			if key != "opts" {
+				input.name = key
+				if field.Value != nil {
+					input.defaultValue = fmt.Sprint(field.Value)
+				}
+				continue
+			}
+
+			opts, ok := field.Value.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			for _, opt := range opts {
+				if opt.Key == "summary" || (opt.Key == "title" && input.summary == "") {
+					input.summary = strings.TrimSpace(fmt.Sprint(opt.Value))
+				}
+			}
+		}
+		if input.name == "" {
+			return nil, errors.New("parsing step definition failed: input without a name")
+		}
+		inputs = append(inputs, input)
+	}
+
+	return inputs, nil
+}
+
+// inputValue is a config file value, lists are accepted for the multiline inputs
+type inputValue string
+
+// UnmarshalYAML keeps the original text of scalars (yes stays "yes"), and joins lists by new lines
+func (v *inputValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*v = inputValue(value)
+		return nil
+	}
+
+	var values []string
+	if err := unmarshal(&values); err != nil {
+		return errors.New("value should be a string or a list of strings")
+	}
+	*v = inputValue(strings.Join(values, "\n"))
+	return nil
+}
+
+func readConfigFile(pth string, inputs []stepInput) (map[string]string, error) {
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file failed: %v", err)
+	}
+
+	var values map[string]inputValue
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("parsing config file (%s) failed: %v", pth, err)
+	}
+
+	known := map[string]bool{}
+	for _, input := range inputs {
+		known[input.name] = true
+	}
+
+	config := map[string]string{}
+	for name, value := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("config file (%s) contains an unknown input: %s", pth, name)
+		}
+		config[name] = string(value)
+	}
+	return config, nil
+}
+
+// inputFlag sets an input value, all the flags of the same input share the destination
+type inputFlag struct {
+	name   string
+	values map[string]string
+}
+
+func (f inputFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return f.values[f.name]
+}
+
+func (f inputFlag) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func flagName(inputName string) string {
+	return strings.ReplaceAll(inputName, "_", "-")
+}
+
+// checkoutInputs resolves the input values of the checkout command.
+// The Step's default values (with environment variables expanded) are overridden by the config file,
+// which is overridden by the flags.
+func checkoutInputs(args []string, output io.Writer) (map[string]string, error) {
+	inputs, err := parseStepInputs(stepYML)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := flag.NewFlagSet(checkoutCommand, flag.ContinueOnError)
+	flags.SetOutput(output)
+	configPath := flags.String("config", "", "YAML file of input values, keyed by the Step input names")
+
+	flagValues := map[string]string{}
+	for _, input := range inputs {
+		flags.Var(inputFlag{name: input.name, values: flagValues}, flagName(input.name), input.summary)
+	}
+	aliases := make([]string, 0, len(flagAliases))
+	for alias := range flagAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		name := flagAliases[alias]
+		flags.Var(inputFlag{name: name, values: flagValues}, alias, fmt.Sprintf("Alias of --%s", flagName(name)))
+	}
+
+	flags.Usage = func() {
+		fmt.Fprintf(output, "Usage: git-clone %s [flags]\n\n", checkoutCommand)
+		fmt.Fprintf(output, "Checks out the repository the same way as the Step does.\n")
+		fmt.Fprintf(output, "Every Step input is available as a flag, the Step's default values are used for the rest.\n\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	values := map[string]string{}
+	for _, input := range inputs {
+		values[input.name] = os.ExpandEnv(input.defaultValue)
+	}
+
+	if *configPath != "" {
+		config, err := readConfigFile(*configPath, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range config {
+			values[name] = value
+		}
+	}
+
+	for name, value := range flagValues {
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// parseConfig parses the input values the same way as the Step does, from environment variables
+func parseConfig(values map[string]string) (gitclone.Config, error) {
+	for name, value := range values {
+		if err := os.Setenv(name, value); err != nil {
+			return gitclone.Config{}, fmt.Errorf("setting input (%s) failed: %v", name, err)
+		}
+	}
+
+	var cfg gitclone.Config
+	if err := stepconf.Parse(&cfg); err != nil {
+		return gitclone.Config{}, err
+	}
+	return cfg, nil
+}
+
+func printUsage(output io.Writer) {
+	fmt.Fprintf(output, "Usage: git-clone [command]\n\n")
+	fmt.Fprintf(output, "Without a command the Step inputs are read from environment variables.\n\n")
+	fmt.Fprintf(output, "Commands:\n")
+	fmt.Fprintf(output, "  %s\tcheck out the repository configured by flags or a config file\n", checkoutCommand)
+	fmt.Fprintf(output, "  help\tprint this help\n")
+}
+
+// runCLI runs the command line interface, and returns the exit code
+func runCLI(args []string) int {
+	switch args[0] {
+	case checkoutCommand:
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	values, err := checkoutInputs(args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+
+	cfg, err := parseConfig(values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+
+	if err := run(cfg); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseStepInputs(t *testing.T) {
+	inputs, err := parseStepInputs(stepYML)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	byName := map[string]stepInput{}
+	for _, input := range inputs {
+		byName[input.name] = input
+	}
+
+	assert.Equal(t, "repository_url", inputs[0].name)
+	assert.Equal(t, "$GIT_REPOSITORY_URL", byName["repository_url"].defaultValue)
+	assert.Equal(t, "yes", byName["update_submodules"].defaultValue)
+	assert.Equal(t, "", byName["clone_depth"].defaultValue)
+	assert.NotEmpty(t, byName["clone_depth"].summary)
+}
+
+func Test_checkoutInputs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+	config := `repository_url: https://github.com/bitrise-io/git-clone-test.git
+branch: master
+update_submodules: no
+sparse_directories:
+  - app
+  - lib
+`
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(config), 0600))
+
+	unknownConfigPath := filepath.Join(dir, "unknown.yml")
+	assert.NoError(t, ioutil.WriteFile(unknownConfigPath, []byte("repository: x\n"), 0600))
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "flags and aliases",
+			args: []string{"--repo", "git@github.com:bitrise-io/git-clone-test.git", "--pr-dest", "master", "--depth", "1", "--merge-pr", "no"},
+			want: map[string]string{
+				"repository_url": "git@github.com:bitrise-io/git-clone-test.git",
+				"branch_dest":    "master",
+				"clone_depth":    "1",
+				"merge_pr":       "no",
+				"retry_count":    "2",
+			},
+		},
+		{
+			name: "config file",
+			args: []string{"--config", configPath},
+			want: map[string]string{
+				"repository_url":     "https://github.com/bitrise-io/git-clone-test.git",
+				"branch":             "master",
+				"update_submodules":  "no",
+				"sparse_directories": "app\nlib",
+			},
+		},
+		{
+			name: "flags override the config file",
+			args: []string{"--config", configPath, "--branch", "develop"},
+			want: map[string]string{
+				"repository_url": "https://github.com/bitrise-io/git-clone-test.git",
+				"branch":         "develop",
+			},
+		},
+		{
+			name:    "unknown input in the config file",
+			args:    []string{"--config", unknownConfigPath},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--repository", "x"},
+			wantErr: true,
+		},
+		{
+			name:    "positional argument",
+			args:    []string{"x"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkoutInputs(tt.args, ioutil.Discard)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+			for name, value := range tt.want {
+				assert.Equal(t, value, got[name], name)
+			}
+		})
+	}
+}
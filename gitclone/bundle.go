@@ -0,0 +1,95 @@
+package gitclone
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	seedBundleFailedTag = "seed_bundle_failed"
+	// Bundle refs are kept in a separate namespace, so they do not interfere with the remote tracking branches,
+	// but they are still advertised as local refs while negotiating the following fetches.
+	// They are removed once the checkout is done (see removeBundleRefs).
+	bundleRefNamespace = "refs/bundle/"
+	bundleRefspec      = "+refs/*:" + bundleRefNamespace + "*"
+)
+
+// bundlePath returns the local path of a bundle given as a local path or a file:// URL
+func bundlePath(bundle string) (string, error) {
+	u, err := url.Parse(bundle)
+	if err != nil {
+		return "", fmt.Errorf("could not parse bundle URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "":
+		return pathutil.AbsPath(bundle)
+	case "file":
+		return pathutil.AbsPath(u.Path)
+	default:
+		return "", fmt.Errorf("unsupported bundle URL scheme (%s), use a local path or a file:// URL", u.Scheme)
+	}
+}
+
+// seedFromBundle fetches the objects of a bundle into the repository, so the following fetches from the remote
+// only transfer the objects newer than the bundle's refs.
+// A missing, corrupt or unrelated bundle is skipped, the repository is then fetched from the remote only.
+func seedFromBundle(gitCmd gitRunner, bundle string) error {
+	pth, err := bundlePath(bundle)
+	if err != nil {
+		return err
+	}
+
+	if exist, err := pathutil.IsPathExists(pth); err != nil {
+		return err
+	} else if !exist {
+		gitCmd.log.Warnf("Seed bundle (%s) does not exist, fetching without it", pth)
+		return nil
+	}
+
+	// Fails if the bundle is corrupt or its prerequisite commits are missing from the repository
+	if err := gitCmd.runner.Run(gitCommand(gitCmd, "bundle", "verify", pth)); err != nil {
+		gitCmd.log.Warnf("Seed bundle (%s) can not be used, fetching without it: %v", pth, err)
+		return nil
+	}
+
+	if err := gitCmd.runner.Run(gitCmd.Fetch("--no-tags", "--no-recurse-submodules", pth, bundleRefspec)); err != nil {
+		gitCmd.log.Warnf("Failed to fetch from seed bundle (%s), fetching without it: %v", pth, err)
+		return nil
+	}
+
+	gitCmd.log.Donef("Repository seeded from bundle: %s", pth)
+	return nil
+}
+
+// removeBundleRefs deletes the refs fetched from the seed bundle, so they do not show up in the history
+// (for example in git log --all, git describe or the tag lookups). The objects only reachable from them are left for gc.
+func removeBundleRefs(gitCmd gitRunner) error {
+	out, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "for-each-ref", "--format=%(refname)", bundleRefNamespace))
+	if err != nil {
+		return fmt.Errorf("listing bundle refs failed: %v", err)
+	}
+
+	var refs []string
+	for _, ref := range strings.Split(out, "\n") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var stdin strings.Builder
+	for _, ref := range refs {
+		stdin.WriteString("delete " + ref + "\n")
+	}
+	if err := gitCmd.runner.Run(gitCommand(gitCmd, "update-ref", "--stdin").SetStdin(strings.NewReader(stdin.String()))); err != nil {
+		return fmt.Errorf("deleting bundle refs failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package gitclone
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bundlePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "Local path",
+			bundle: "/tmp/cache/repo.bundle",
+			want:   "/tmp/cache/repo.bundle",
+		},
+		{
+			name:   "File URL",
+			bundle: "file:///tmp/cache/repo.bundle",
+			want:   "/tmp/cache/repo.bundle",
+		},
+		{
+			name:    "Remote URL",
+			bundle:  "https://example.com/repo.bundle",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bundlePath(tt.bundle)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_seedFromBundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	assert.NoError(t, ioutil.WriteFile(bundle, []byte("# v2 git bundle"), 0644))
+
+	tests := []struct {
+		name       string
+		bundle     string
+		mockRunner *MockRunner
+		wantCmds   []string
+	}{
+		{
+			name:   "Seed from bundle",
+			bundle: "file://" + bundle,
+			wantCmds: []string{
+				`git "bundle" "verify" "` + bundle + `"`,
+				`git "fetch" "--no-tags" "--no-recurse-submodules" "` + bundle + `" "+refs/*:refs/bundle/*"`,
+			},
+		},
+		{
+			name:   "Corrupt or unrelated bundle is skipped",
+			bundle: bundle,
+			mockRunner: givenMockRunner().
+				GivenRunFailsForCommand(`git "bundle" "verify" "`+bundle+`"`, 1).
+				GivenRunSucceeds(),
+			wantCmds: []string{
+				`git "bundle" "verify" "` + bundle + `"`,
+			},
+		},
+		{
+			name:     "Missing bundle is skipped",
+			bundle:   bundle + ".missing",
+			wantCmds: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			mockRunner := tt.mockRunner
+			if mockRunner == nil {
+				mockRunner = givenMockRunnerSucceeds()
+			}
+
+			// When
+			actualErr := seedFromBundle(gitRunner{runner: mockRunner}, tt.bundle)
+
+			// Then
+			assert.NoError(t, actualErr)
+			assert.Equal(t, tt.wantCmds, mockRunner.Cmds())
+		})
+	}
+}
+
+func Test_removeBundleRefs(t *testing.T) {
+	// Given
+	mockRunner := new(MockRunner).
+		GivenRunForOutputSucceedsForCommand(`git "for-each-ref" "--format=%(refname)" "refs/bundle/"`, "refs/bundle/heads/master\nrefs/bundle/tags/1.0.0").
+		GivenRunSucceeds()
+
+	// When
+	err := removeBundleRefs(gitRunner{runner: mockRunner})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`git "for-each-ref" "--format=%(refname)" "refs/bundle/"`,
+		`git "update-ref" "--stdin"`,
+	}, mockRunner.Cmds())
+}
@@ -2,9 +2,6 @@ package gitclone
 
 import (
 	"fmt"
-
-	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 )
 
 // CheckoutMethod is the checkout method used
@@ -33,6 +30,27 @@ const (
 	CheckoutForkCommitMethod
 )
 
+var checkoutMethodNames = map[CheckoutMethod]string{
+	InvalidCheckoutMethod:          "invalid",
+	CheckoutNoneMethod:             "none",
+	CheckoutCommitMethod:           "commit",
+	CheckoutTagMethod:              "tag",
+	CheckoutBranchMethod:           "branch",
+	CheckoutPRMergeBranchMethod:    "pr_merge_branch",
+	CheckoutPRDiffFileMethod:       "pr_diff_file",
+	CheckoutPRManualMergeMethod:    "pr_manual_merge",
+	CheckoutHeadBranchCommitMethod: "head_branch_commit",
+	CheckoutForkCommitMethod:       "fork_commit",
+}
+
+// String ...
+func (m CheckoutMethod) String() string {
+	if name, ok := checkoutMethodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("CheckoutMethod(%d)", int(m))
+}
+
 const privateForkAuthWarning = `May fail due to missing authentication as Pull Request opened from a private fork.
 A git hosting provider head branch or a diff file is unavailable.`
 
@@ -53,7 +71,7 @@ func NewParameterValidationError(msg string) error {
 
 // checkoutStrategy is the interface an actual checkout strategy implements
 type checkoutStrategy interface {
-	do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error
+	do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error
 }
 
 // X: required parameter
@@ -71,78 +89,108 @@ type checkoutStrategy interface {
 // | headBranch  |        |     |        |          |  X         |           |
 // |=========================================================================|
 
-func selectCheckoutMethod(cfg Config, patch patchSource) (CheckoutMethod, string) {
+func selectCheckoutMethod(cfg Config, patch PatchSource, decisions *decisionLog, log logger) (CheckoutMethod, string) {
 	isPR := cfg.PRSourceRepositoryURL != "" || cfg.PRDestBranch != "" || cfg.PRMergeBranch != "" || cfg.PRID != 0
 	if !isPR {
+		decisions.add("not a Pull Request build: no Pull Request source repository URL, destination branch, merge branch or ID specified")
+
 		if cfg.Commit != "" {
+			decisions.add("commit specified (%s)", cfg.Commit)
 			return CheckoutCommitMethod, ""
 		}
 
 		if cfg.Tag != "" {
+			decisions.add("tag specified (%s)", cfg.Tag)
 			return CheckoutTagMethod, ""
 		}
 
 		if cfg.Branch != "" {
+			decisions.add("branch specified (%s)", cfg.Branch)
 			return CheckoutBranchMethod, ""
 		}
 
+		decisions.add("no commit, tag or branch specified")
 		return CheckoutNoneMethod, ""
 	}
-
-	isFork := isFork(cfg.RepositoryURL, cfg.PRSourceRepositoryURL)
-	isPrivateSourceRepo := isPrivate(cfg.PRSourceRepositoryURL)
+	decisions.add("Pull Request build")
+
+	isFork, reason := isForkPR(cfg, log)
+	decisions.add(reason)
+	isPrivateSourceRepo := false
+	if isFork {
+		isPrivateSourceRepo, reason = isPrivatePRSource(cfg)
+		decisions.add(reason)
+	}
 	isPrivateFork := isFork && isPrivateSourceRepo
 	isPublicFork := isFork && !isPrivateSourceRepo
 
 	if !cfg.ShouldMergePR {
+		decisions.add("merging the Pull Request is disabled (merge_pr: no)")
+
 		if cfg.PRHeadBranch != "" {
+			decisions.add("head branch specified (%s)", cfg.PRHeadBranch)
 			return CheckoutHeadBranchCommitMethod, ""
 		}
 
 		if !isFork {
+			decisions.add("no head branch specified, checking out the commit")
 			return CheckoutCommitMethod, ""
 		}
 
 		if isPublicFork {
+			decisions.add("no head branch specified, checking out the commit from the public fork")
 			return CheckoutForkCommitMethod, ""
 		}
 
 		if cfg.BuildURL != "" {
-			patchFile := getPatchFile(patch, cfg.BuildURL, cfg.BuildAPIToken)
+			patchFile := getPatchFile(patch, cfg.BuildURL, string(cfg.BuildAPIToken), log)
 			if patchFile != "" {
+				decisions.add("the private fork may not be accessible, merging the diff file despite the option to disable merging")
 				log.Infof("Merging Pull Request despite the option to disable merging, as it is opened from a private fork.")
 				return CheckoutPRDiffFileMethod, patchFile
 			}
+			decisions.add("diff file unavailable")
 		}
 
+		decisions.add("checking out the commit from the private fork, may fail due to missing authentication")
 		log.Warnf(privateForkAuthWarning)
 		return CheckoutForkCommitMethod, ""
 	}
 
 	if !cfg.ManualMerge || isPrivateFork {
+		if isPrivateFork {
+			decisions.add("the private fork may not be accessible, using a merge ref or a diff file provided by the git hosting provider")
+		} else {
+			decisions.add("manual merge is disabled (manual_merge: no)")
+		}
+
 		if cfg.PRMergeBranch != "" {
+			decisions.add("merge branch specified (%s)", cfg.PRMergeBranch)
 			return CheckoutPRMergeBranchMethod, ""
 		}
 
 		if cfg.BuildURL != "" {
-			patchFile := getPatchFile(patch, cfg.BuildURL, cfg.BuildAPIToken)
+			patchFile := getPatchFile(patch, cfg.BuildURL, string(cfg.BuildAPIToken), log)
 			if patchFile != "" {
+				decisions.add("no merge branch specified, diff file available")
 				return CheckoutPRDiffFileMethod, patchFile
 			}
 		}
 
+		decisions.add("no merge branch or diff file available, merging manually")
 		log.Warnf(privateForkAuthWarning)
 		return CheckoutPRManualMergeMethod, ""
 	}
 
+	decisions.add("manual merge is enabled (manual_merge: yes)")
 	return CheckoutPRManualMergeMethod, ""
 }
 
-func getPatchFile(patch patchSource, buildURL, buildAPIToken string) string {
+func getPatchFile(patch PatchSource, buildURL, buildAPIToken string, log logger) string {
 	if patch != nil {
-		patchFile, err := patch.getDiffPath(buildURL, buildAPIToken)
+		patchFile, err := patch.DiffPath(buildURL, buildAPIToken)
 		if err != nil {
-			log.Warnf("Diff file unavailable: %v", err)
+			log.Warnf("Diff file unavailable: %s", Redact(err.Error()))
 		} else {
 			return patchFile
 		}
@@ -151,7 +199,7 @@ func getPatchFile(patch patchSource, buildURL, buildAPIToken string) string {
 	return ""
 }
 
-func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile string) (checkoutStrategy, error) {
+func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile string, log logger) (checkoutStrategy, error) {
 	switch checkoutMethod {
 	case CheckoutNoneMethod:
 		{
@@ -203,12 +251,13 @@ func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile
 			}
 
 			return checkoutPRMergeBranch{
-				params: *params,
+				params:   *params,
+				maxDepth: cfg.UnshallowMaxDepth,
 			}, nil
 		}
 	case CheckoutPRDiffFileMethod:
 		{
-			prManualMergeStrategy, err := createCheckoutStrategy(CheckoutPRManualMergeMethod, cfg, patchFile)
+			prManualMergeStrategy, err := createCheckoutStrategy(CheckoutPRManualMergeMethod, cfg, patchFile, log)
 			if err != nil {
 				return nil, err
 			}
@@ -226,7 +275,7 @@ func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile
 	case CheckoutPRManualMergeMethod:
 		{
 			prRepositoryURL := ""
-			if isFork(cfg.RepositoryURL, cfg.PRSourceRepositoryURL) {
+			if isFork, _ := isForkPR(cfg, log); isFork {
 				prRepositoryURL = cfg.PRSourceRepositoryURL
 			}
 
@@ -236,7 +285,8 @@ func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile
 			}
 
 			return checkoutPRManualMerge{
-				params: *params,
+				params:   *params,
+				maxDepth: cfg.UnshallowMaxDepth,
 			}, nil
 		}
 	case CheckoutHeadBranchCommitMethod:
@@ -269,20 +319,44 @@ func createCheckoutStrategy(checkoutMethod CheckoutMethod, cfg Config, patchFile
 
 }
 
-func selectFetchOptions(checkoutStrategy CheckoutMethod, cloneDepth int, fetchTags, fetchSubmodules bool, filterTree bool) fetchOptions {
+func selectFetchOptions(checkoutStrategy CheckoutMethod, cloneDepth int, fetchTags, fetchSubmodules bool, filter string, isSparse bool, log logger) fetchOptions {
 	opts := fetchOptions{
 		depth:           cloneDepth,
 		tags:            fetchTags,
 		fetchSubmodules: fetchSubmodules,
 	}
 
-	opts = selectFilterTreeFetchOption(checkoutStrategy, opts, filterTree)
+	opts = selectFilterFetchOption(checkoutStrategy, opts, filter, isSparse, log)
 
 	return opts
 }
 
-func selectFilterTreeFetchOption(checkoutStrategy CheckoutMethod, opts fetchOptions, filterTree bool) fetchOptions {
-	if !filterTree {
+func isMergeCheckoutMethod(checkoutStrategy CheckoutMethod) bool {
+	switch checkoutStrategy {
+	case CheckoutPRMergeBranchMethod, CheckoutPRDiffFileMethod, CheckoutPRManualMergeMethod:
+		return true
+	default:
+		return false
+	}
+}
+
+func selectFilterFetchOption(checkoutStrategy CheckoutMethod, opts fetchOptions, filter string, isSparse bool, log logger) fetchOptions {
+	if checkoutStrategy == CheckoutNoneMethod || filter == cloneFilterNone {
+		return opts
+	}
+
+	if isExplicitCloneFilter(filter) {
+		// Merging needs the trees of both branches, a treeless clone would download them one by one
+		if filter == cloneFilterTreeless && isMergeCheckoutMethod(checkoutStrategy) {
+			log.Warnf("Treeless clone (%s) is not supported when merging a Pull Request, using blobless clone (%s) instead", cloneFilterTreeless, cloneFilterBlobless)
+			filter = cloneFilterBlobless
+		}
+
+		opts.filter = filter
+		return opts
+	}
+
+	if !isSparse {
 		return opts
 	}
 
@@ -292,15 +366,19 @@ func selectFilterTreeFetchOption(checkoutStrategy CheckoutMethod, opts fetchOpti
 		CheckoutBranchMethod,
 		CheckoutHeadBranchCommitMethod,
 		CheckoutForkCommitMethod:
-		opts.filterTree = true
+		opts.filter = cloneFilterTreeless
 		opts.depth = 0
+	case CheckoutPRMergeBranchMethod,
+		CheckoutPRDiffFileMethod,
+		CheckoutPRManualMergeMethod:
+		opts.filter = cloneFilterBlobless
 	default:
 	}
 
 	return opts
 }
 
-func selectFallbacks(checkoutStrategy CheckoutMethod, fetchOpts fetchOptions) fallbackRetry {
+func selectFallbacks(checkoutStrategy CheckoutMethod, fetchOpts fetchOptions, unshallowStrategy string, unshallowMaxDepth int) fallbackRetry {
 	if fetchOpts.IsFullDepth() {
 		return nil
 	}
@@ -308,6 +386,8 @@ func selectFallbacks(checkoutStrategy CheckoutMethod, fetchOpts fetchOptions) fa
 	unshallowFetchOpts := unshallowFetchOptions{
 		tags:            fetchOpts.tags,
 		fetchSubmodules: fetchOpts.fetchSubmodules,
+		filter:          fetchOpts.filter,
+		progress:        fetchOpts.progress,
 	}
 
 	switch checkoutStrategy {
@@ -315,10 +395,27 @@ func selectFallbacks(checkoutStrategy CheckoutMethod, fetchOpts fetchOptions) fa
 		// the given branch's tip will be checked out, no need to unshallow
 		return nil
 	case CheckoutCommitMethod, CheckoutTagMethod, CheckoutHeadBranchCommitMethod, CheckoutForkCommitMethod:
+		if unshallowStrategy == unshallowStrategyProgressive {
+			return progressiveUnshallow{
+				traits:       unshallowFetchOpts,
+				initialDepth: fetchOpts.depth,
+				maxDepth:     unshallowMaxDepth,
+			}
+		}
+
 		return simpleUnshallow{
 			traits: unshallowFetchOpts,
 		}
 	case CheckoutPRMergeBranchMethod, CheckoutPRManualMergeMethod, CheckoutPRDiffFileMethod:
+		if unshallowStrategy == unshallowStrategyProgressive {
+			return progressiveUnshallow{
+				traits:       unshallowFetchOpts,
+				initialDepth: fetchOpts.depth,
+				maxDepth:     unshallowMaxDepth,
+				reset:        true,
+			}
+		}
+
 		return resetUnshallow{
 			traits: unshallowFetchOpts,
 		}
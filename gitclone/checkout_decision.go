@@ -0,0 +1,60 @@
+package gitclone
+
+import (
+	"fmt"
+)
+
+const (
+	detectionAuto = "auto"
+	detectionYes  = "yes"
+	detectionNo   = "no"
+)
+
+// decisionLog explains why a checkout method was selected
+type decisionLog []string
+
+func (d *decisionLog) add(format string, v ...interface{}) {
+	*d = append(*d, fmt.Sprintf(format, v...))
+}
+
+func (d decisionLog) print(log logger) {
+	log.Infof("Checkout method selection:")
+	for i, decision := range d {
+		log.Printf("%d. %s", i+1, decision)
+	}
+}
+
+// isForkPR returns whether the Pull Request is opened from a fork, as set by the pull_request_is_fork input,
+// or detected by comparing the repository URLs
+func isForkPR(cfg Config, log logger) (bool, string) {
+	switch cfg.PRIsFork {
+	case detectionYes:
+		return true, "the Pull Request is opened from a fork (pull_request_is_fork: yes)"
+	case detectionNo:
+		return false, "the Pull Request is not opened from a fork (pull_request_is_fork: no)"
+	}
+
+	if cfg.PRSourceRepositoryURL == "" {
+		return false, "the Pull Request is not opened from a fork: no source repository URL specified"
+	}
+	if isFork(cfg.RepositoryURL, cfg.PRSourceRepositoryURL, log) {
+		return true, fmt.Sprintf("the Pull Request is opened from a fork: the source repository (%s) differs from the repository (%s)", Redact(cfg.PRSourceRepositoryURL), Redact(cfg.RepositoryURL))
+	}
+	return false, fmt.Sprintf("the Pull Request is not opened from a fork: the source repository (%s) is the same as the repository (%s)", Redact(cfg.PRSourceRepositoryURL), Redact(cfg.RepositoryURL))
+}
+
+// isPrivatePRSource returns whether the Pull Request's source repository is private, as set by the pull_request_source_private input,
+// or detected by the source repository URL requiring authentication (SSH URL or HTTP(S) URL with credentials)
+func isPrivatePRSource(cfg Config) (bool, string) {
+	switch cfg.PRSourcePrivate {
+	case detectionYes:
+		return true, "the source repository is private (pull_request_source_private: yes)"
+	case detectionNo:
+		return false, "the source repository is public (pull_request_source_private: no)"
+	}
+
+	if isPrivate(cfg.PRSourceRepositoryURL) {
+		return true, fmt.Sprintf("the source repository is considered private: its URL (%s) requires authentication", Redact(cfg.PRSourceRepositoryURL))
+	}
+	return false, fmt.Sprintf("the source repository is considered public: its URL (%s) does not require authentication", Redact(cfg.PRSourceRepositoryURL))
+}
@@ -0,0 +1,113 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_selectCheckoutMethod_explicitForkDetection(t *testing.T) {
+	sshForkPR := Config{
+		RepositoryURL:         "https://github.com/bitrise-io/git-clone-test.git",
+		PRSourceRepositoryURL: "git@github.com:bitrise-io/other-repo.git",
+		PRDestBranch:          "master",
+		PRMergeBranch:         "pull/7/merge",
+		Branch:                "test/commit-messages",
+		ShouldMergePR:         true,
+		ManualMerge:           true,
+	}
+
+	tests := []struct {
+		name          string
+		isFork        string
+		sourcePrivate string
+		want          CheckoutMethod
+		wantDecisions decisionLog
+	}{
+		{
+			name:          "auto: SSH fork is considered private",
+			isFork:        detectionAuto,
+			sourcePrivate: detectionAuto,
+			want:          CheckoutPRMergeBranchMethod,
+			wantDecisions: decisionLog{
+				"Pull Request build",
+				"the Pull Request is opened from a fork: the source repository (git@github.com:bitrise-io/other-repo.git) differs from the repository (https://github.com/bitrise-io/git-clone-test.git)",
+				"the source repository is considered private: its URL (git@github.com:bitrise-io/other-repo.git) requires authentication",
+				"the private fork may not be accessible, using a merge ref or a diff file provided by the git hosting provider",
+				"merge branch specified (pull/7/merge)",
+			},
+		},
+		{
+			name:          "public SSH fork",
+			isFork:        detectionAuto,
+			sourcePrivate: detectionNo,
+			want:          CheckoutPRManualMergeMethod,
+			wantDecisions: decisionLog{
+				"Pull Request build",
+				"the Pull Request is opened from a fork: the source repository (git@github.com:bitrise-io/other-repo.git) differs from the repository (https://github.com/bitrise-io/git-clone-test.git)",
+				"the source repository is public (pull_request_source_private: no)",
+				"manual merge is enabled (manual_merge: yes)",
+			},
+		},
+		{
+			name:          "not a fork",
+			isFork:        detectionNo,
+			sourcePrivate: detectionYes,
+			want:          CheckoutPRManualMergeMethod,
+			wantDecisions: decisionLog{
+				"Pull Request build",
+				"the Pull Request is not opened from a fork (pull_request_is_fork: no)",
+				"manual merge is enabled (manual_merge: yes)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sshForkPR
+			cfg.PRIsFork = tt.isFork
+			cfg.PRSourcePrivate = tt.sourcePrivate
+
+			var decisions decisionLog
+			got, _ := selectCheckoutMethod(cfg, nil, &decisions, logger{})
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantDecisions, decisions)
+		})
+	}
+}
+
+func Test_isForkPR(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{
+			name: "detected fork",
+			cfg:  Config{RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git", PRSourceRepositoryURL: "https://github.com/other/git-clone-test.git"},
+			want: true,
+		},
+		{
+			name: "detected same repository",
+			cfg:  Config{RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git", PRSourceRepositoryURL: "git@github.com:bitrise-io/git-clone-test.git"},
+			want: false,
+		},
+		{
+			name: "explicit fork",
+			cfg:  Config{RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git", PRSourceRepositoryURL: "git@github.com:bitrise-io/git-clone-test.git", PRIsFork: detectionYes},
+			want: true,
+		},
+		{
+			name: "explicit not fork",
+			cfg:  Config{RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git", PRSourceRepositoryURL: "https://github.com/other/git-clone-test.git", PRIsFork: detectionNo},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := isForkPR(tt.cfg, logger{})
+			assert.Equal(t, tt.want, got)
+			assert.NotEmpty(t, reason)
+		})
+	}
+}
@@ -1,13 +1,12 @@
 package gitclone
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/bitrise-io/go-utils/command"
-	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 )
 
 type fetchOptions struct {
@@ -19,12 +18,21 @@ type fetchOptions struct {
 	// Sets '--depth' flag
 	// More info: https://git-scm.com/docs/fetch-options/2.29.0#Documentation/fetch-options.txt---depthltdepthgt
 	depth int
+	// Sets '--deepen' flag, deepens the history of a shallow repository (used instead of depth)
+	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---deepenltdepthgt
+	deepen int
 	// Sets '--no-recurse-submodules' flag
 	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---no-recurse-submodules
 	fetchSubmodules bool
-	// Sets `--filter=tree:0` flag
-	// More info: https://github.blog/2020-12-21-get-up-to-speed-with-partial-clone-and-shallow-clone/#user-content-treeless-clones
-	filterTree bool
+	// Sets `--filter=<filter-spec>` flag (for example `blob:none` or `tree:0`)
+	// More info:
+	// - https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---filterltfilter-specgt
+	// - https://github.blog/2020-12-21-get-up-to-speed-with-partial-clone-and-shallow-clone/
+	filter string
+	// Sets '--progress' flag, so the progress is reported even if the output is not a terminal (used for the metrics and the stall detection).
+	// The submodule update always sets it. The progress updates are not written to the log (see progressFilter).
+	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---progress
+	progress bool
 }
 
 func (t fetchOptions) IsFullDepth() bool {
@@ -36,15 +44,17 @@ const (
 	refsHeadsPrefix = "refs/heads/"
 )
 
-func fetch(gitCmd git.Git, remote string, ref string, traits fetchOptions) error {
+func fetch(gitCmd gitRunner, remote string, ref string, traits fetchOptions) error {
 	var opts []string
 	opts = append(opts, jobsFlag)
 
-	if traits.depth != 0 {
+	if traits.deepen != 0 {
+		opts = append(opts, "--deepen="+strconv.Itoa(traits.deepen))
+	} else if traits.depth != 0 {
 		opts = append(opts, "--depth="+strconv.Itoa(traits.depth))
 	}
-	if traits.filterTree {
-		opts = append(opts, `--filter=tree:0`)
+	if traits.filter != "" {
+		opts = append(opts, "--filter="+traits.filter)
 	}
 
 	if traits.tags {
@@ -55,6 +65,9 @@ func fetch(gitCmd git.Git, remote string, ref string, traits fetchOptions) error
 	if !traits.fetchSubmodules {
 		opts = append(opts, "--no-recurse-submodules")
 	}
+	if traits.progress {
+		opts = append(opts, "--progress")
+	}
 	if ref != "" {
 		opts = append(opts, remote, ref)
 	}
@@ -65,9 +78,18 @@ func fetch(gitCmd git.Git, remote string, ref string, traits fetchOptions) error
 		branch = strings.TrimPrefix(ref, refsHeadsPrefix)
 	}
 
-	if err := runner.RunWithRetry(func() *command.Model {
+	if err := gitCmd.runner.RunWithRetry(func() *command.Model {
 		return gitCmd.Fetch(opts...)
 	}); err != nil {
+		var timeoutErr commandTimeoutError
+		if errors.As(err, &timeoutErr) {
+			return newStepError(
+				timeoutErr.tag("fetch"),
+				fmt.Errorf("fetch failed: %v", err),
+				"Fetching repository has timed out",
+			)
+		}
+
 		return handleCheckoutError(
 			listBranches(gitCmd),
 			fetchFailedTag,
@@ -80,15 +102,14 @@ func fetch(gitCmd git.Git, remote string, ref string, traits fetchOptions) error
 	return nil
 }
 
-func checkoutWithCustomRetry(gitCmd git.Git, arg string, retry fallbackRetry) error {
-	if cErr := runner.Run(gitCmd.Checkout(arg)); cErr != nil {
+func checkoutWithCustomRetry(gitCmd gitRunner, arg string, retry fallbackRetry) error {
+	if cErr := gitCmd.runner.Run(gitCmd.Checkout(arg)); cErr != nil {
 		if retry != nil {
-			log.Warnf("Checkout failed (%s): %v", arg, cErr)
-			if err := retry.do(gitCmd); err != nil {
-				return err
-			}
+			gitCmd.log.Warnf("Checkout failed (%s): %v", arg, cErr)
 
-			return runner.Run(gitCmd.Checkout(arg))
+			return retryWithFallback(gitCmd, retry, func() error {
+				return gitCmd.runner.Run(gitCmd.Checkout(arg))
+			})
 		}
 
 		return fmt.Errorf("checkout failed (%s): %v", arg, cErr)
@@ -97,7 +118,7 @@ func checkoutWithCustomRetry(gitCmd git.Git, arg string, retry fallbackRetry) er
 	return nil
 }
 
-func fetchInitialBranch(gitCmd git.Git, remote string, branchRef string, fetchTraits fetchOptions) error {
+func fetchInitialBranch(gitCmd gitRunner, remote string, branchRef string, fetchTraits fetchOptions) error {
 	branch := strings.TrimPrefix(branchRef, refsHeadsPrefix)
 	if err := fetch(gitCmd, remote, branchRef, fetchTraits); err != nil {
 		return err
@@ -115,7 +136,7 @@ func fetchInitialBranch(gitCmd git.Git, remote string, branchRef string, fetchTr
 
 	// Update branch: 'git fetch' followed by a 'git merge' is the same as 'git pull'.
 	remoteBranch := fmt.Sprintf("%s/%s", remote, branch)
-	if err := runner.Run(gitCmd.Merge(remoteBranch)); err != nil {
+	if err := gitCmd.runner.Run(gitCmd.Merge(remoteBranch)); err != nil {
 		return newStepError(
 			"update_branch_failed",
 			fmt.Errorf("updating branch (merge) failed %s: %v", branch, err),
@@ -126,15 +147,14 @@ func fetchInitialBranch(gitCmd git.Git, remote string, branchRef string, fetchTr
 	return nil
 }
 
-func mergeWithCustomRetry(gitCmd git.Git, arg string, retry fallbackRetry) error {
-	if mErr := runner.Run(gitCmd.Merge(arg)); mErr != nil {
+func mergeWithCustomRetry(gitCmd gitRunner, arg string, retry fallbackRetry) error {
+	if mErr := gitCmd.runner.Run(gitCmd.Merge(arg)); mErr != nil {
 		if retry != nil {
-			log.Warnf("Merge failed (%s): %v", arg, mErr)
-			if err := retry.do(gitCmd); err != nil {
-				return err
-			}
+			gitCmd.log.Warnf("Merge failed (%s): %v", arg, mErr)
 
-			return runner.Run(gitCmd.Merge(arg))
+			return retryWithFallback(gitCmd, retry, func() error {
+				return gitCmd.runner.Run(gitCmd.Merge(arg))
+			})
 		}
 
 		return fmt.Errorf("merge failed (%s): %v", arg, mErr)
@@ -143,8 +163,8 @@ func mergeWithCustomRetry(gitCmd git.Git, arg string, retry fallbackRetry) error
 	return nil
 }
 
-func detachHead(gitCmd git.Git) error {
-	if err := runner.Run(gitCmd.Checkout("--detach")); err != nil {
+func detachHead(gitCmd gitRunner) error {
+	if err := gitCmd.runner.Run(gitCmd.Checkout("--detach")); err != nil {
 		return newStepError(
 			"detach_head_failed",
 			fmt.Errorf("detaching head failed: %v", err),
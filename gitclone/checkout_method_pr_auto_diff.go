@@ -8,8 +8,6 @@ import (
 	"strings"
 
 	"github.com/bitrise-io/go-steputils/input"
-	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-steplib/bitrise-step-export-universal-apk/filedownloader"
 )
 
@@ -41,7 +39,7 @@ type checkoutPRDiffFile struct {
 	patchFile string
 }
 
-func (c checkoutPRDiffFile) do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error {
+func (c checkoutPRDiffFile) do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error {
 	destBranchRef := refsHeadsPrefix + c.params.DestinationBranch
 	if err := fetch(gitCmd, originRemoteName, destBranchRef, fetchOptions); err != nil {
 		return err
@@ -51,9 +49,9 @@ func (c checkoutPRDiffFile) do(gitCmd git.Git, fetchOptions fetchOptions, fallba
 		return err
 	}
 
-	if err := runner.Run(gitCmd.Apply(c.patchFile)); err != nil {
-		log.Warnf("Could not apply patch (%s): %v", c.patchFile, err)
-		log.Warnf("Falling back to manual merge...")
+	if err := gitCmd.runner.Run(gitCmd.Apply(c.patchFile)); err != nil {
+		gitCmd.log.Warnf("Could not apply patch (%s): %v", c.patchFile, err)
+		gitCmd.log.Warnf("Falling back to manual merge...")
 
 		if err := c.params.PRManualMergeStrategy.do(gitCmd, fetchOptions, fallback); err != nil {
 			return fmt.Errorf("fallback failed for applying patch (%s): %v", c.patchFile, err)
@@ -65,13 +63,16 @@ func (c checkoutPRDiffFile) do(gitCmd git.Git, fetchOptions fetchOptions, fallba
 	return detachHead(gitCmd)
 }
 
-type patchSource interface {
-	getDiffPath(buildURL, apiToken string) (string, error)
+// PatchSource provides the diff file of a Pull Request, used by the diff file checkout method
+type PatchSource interface {
+	// DiffPath returns the local path of the diff file of the build
+	DiffPath(buildURL, apiToken string) (string, error)
 }
 
+// defaultPatchSource downloads the diff file from the Bitrise build
 type defaultPatchSource struct{}
 
-func (defaultPatchSource) getDiffPath(buildURL, apiToken string) (string, error) {
+func (defaultPatchSource) DiffPath(buildURL, apiToken string) (string, error) {
 	url, err := url.Parse(buildURL)
 	if err != nil {
 		return "", fmt.Errorf("could not parse diff file URL: %v", err)
@@ -3,8 +3,6 @@ package gitclone
 import (
 	"fmt"
 	"strings"
-
-	"github.com/bitrise-io/go-utils/command/git"
 )
 
 // PRMergeBranchParams are parameters to check out a Merge/Pull Request (when a merge branch is available)
@@ -32,9 +30,11 @@ func NewPRMergeBranchParams(destBranch, mergeBranch string) (*PRMergeBranchParam
 // checkoutPRMergeBranch
 type checkoutPRMergeBranch struct {
 	params PRMergeBranchParams
+	// Maximum depth to deepen the shallow fetched branches to, while looking for their common ancestor
+	maxDepth int
 }
 
-func (c checkoutPRMergeBranch) do(gitCmd git.Git, fetchOpts fetchOptions, fallback fallbackRetry) error {
+func (c checkoutPRMergeBranch) do(gitCmd gitRunner, fetchOpts fetchOptions, fallback fallbackRetry) error {
 	// Check out initial branch (fetchInitialBranch part1)
 	// `git "fetch" "origin" "refs/heads/master"`
 	destBranchRef := refsHeadsPrefix + c.params.DestinationBranch
@@ -48,6 +48,13 @@ func (c checkoutPRMergeBranch) do(gitCmd git.Git, fetchOpts fetchOptions, fallba
 		return err
 	}
 
+	if err := deepenUntilMergeBase(gitCmd, fetchOpts, c.maxDepth,
+		mergeRef{remote: originRemoteName, ref: destBranchRef, rev: fmt.Sprintf("%s/%s", originRemoteName, c.params.DestinationBranch)},
+		mergeRef{remote: originRemoteName, ref: headBranchRef, rev: mergeArg(c.params.MergeBranch)},
+	); err != nil {
+		return err
+	}
+
 	// Check out initial branch (fetchInitialBranch part2)
 	// `git "checkout" "master"`
 	// `git "merge" "origin/master"`
@@ -55,7 +62,7 @@ func (c checkoutPRMergeBranch) do(gitCmd git.Git, fetchOpts fetchOptions, fallba
 		return err
 	}
 	destBranchWithRemote := fmt.Sprintf("%s/%s", originRemoteName, c.params.DestinationBranch)
-	if err := runner.Run(gitCmd.Merge(destBranchWithRemote)); err != nil {
+	if err := gitCmd.runner.Run(gitCmd.Merge(destBranchWithRemote)); err != nil {
 		return err
 	}
 
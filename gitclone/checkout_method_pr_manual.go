@@ -3,9 +3,6 @@ package gitclone
 import (
 	"fmt"
 	"strings"
-
-	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 )
 
 // PRManualMergeParams are parameters to check out a Merge Request using manual merge
@@ -56,28 +53,30 @@ func validatePRManualMergeParams(sourceBranch, commit, sourceRepoURL, destBranch
 
 type checkoutPRManualMerge struct {
 	params PRManualMergeParams
+	// Maximum depth to deepen the shallow fetched branches to, while looking for their common ancestor
+	maxDepth int
 }
 
-func (c checkoutPRManualMerge) do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error {
+func (c checkoutPRManualMerge) do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error {
 	// Fetch and checkout destinations branch
 	destBranchRef := refsHeadsPrefix + c.params.DestinationBranch
 	if err := fetchInitialBranch(gitCmd, originRemoteName, destBranchRef, fetchOptions); err != nil {
 		return err
 	}
 
-	commitHash, err := runner.RunForOutput(gitCmd.Log("%H"))
+	commitHash, err := gitCmd.runner.RunForOutput(gitCmd.Log("%H"))
 	if err != nil {
-		log.Errorf("log commit hash: %v", err)
+		gitCmd.log.Errorf("log commit hash: %v", err)
 	}
-	log.Printf("commit hash: %s", commitHash)
+	gitCmd.log.Printf("commit hash: %s", commitHash)
 
 	var remoteName string
 	if c.params.SourceRepoURL != "" {
 		remoteName = forkRemoteName
 
 		// Add fork remote
-		if err := runner.Run(gitCmd.RemoteAdd(forkRemoteName, c.params.SourceRepoURL)); err != nil {
-			return fmt.Errorf("adding remote fork repository failed (%s): %v", c.params.SourceRepoURL, err)
+		if err := addForkRemote(gitCmd, c.params.SourceRepoURL); err != nil {
+			return err
 		}
 
 	} else {
@@ -90,6 +89,13 @@ func (c checkoutPRManualMerge) do(gitCmd git.Git, fetchOptions fetchOptions, fal
 		return nil
 	}
 
+	if err := deepenUntilMergeBase(gitCmd, fetchOptions, c.maxDepth,
+		mergeRef{remote: originRemoteName, ref: destBranchRef, rev: fmt.Sprintf("%s/%s", originRemoteName, c.params.DestinationBranch)},
+		mergeRef{remote: remoteName, ref: sourceBranchRef, rev: c.params.SourceMergeArg},
+	); err != nil {
+		return err
+	}
+
 	if err := mergeWithCustomRetry(gitCmd, c.params.SourceMergeArg, fallback); err != nil {
 		return err
 	}
@@ -3,15 +3,13 @@ package gitclone
 import (
 	"fmt"
 	"strings"
-
-	"github.com/bitrise-io/go-utils/command/git"
 )
 
 //
 // checkoutNone
 type checkoutNone struct{}
 
-func (c checkoutNone) do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error {
+func (c checkoutNone) do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error {
 	return nil
 }
 
@@ -41,12 +39,12 @@ type checkoutCommit struct {
 	params CommitParams
 }
 
-func (c checkoutCommit) do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error {
+func (c checkoutCommit) do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error {
 	remote := originRemoteName
 	if c.params.SourceRepoURL != "" {
 		remote = forkRemoteName
-		if err := runner.Run(gitCmd.RemoteAdd(forkRemoteName, c.params.SourceRepoURL)); err != nil {
-			return fmt.Errorf("adding remote fork repository failed (%s): %v", c.params.SourceRepoURL, err)
+		if err := addForkRemote(gitCmd, c.params.SourceRepoURL); err != nil {
+			return err
 		}
 	}
 
@@ -83,7 +81,7 @@ type checkoutBranch struct {
 	params BranchParams
 }
 
-func (c checkoutBranch) do(gitCmd git.Git, fetchOptions fetchOptions, _ fallbackRetry) error {
+func (c checkoutBranch) do(gitCmd gitRunner, fetchOptions fetchOptions, _ fallbackRetry) error {
 	branchRef := refsHeadsPrefix + c.params.Branch
 	if err := fetchInitialBranch(gitCmd, originRemoteName, branchRef, fetchOptions); err != nil {
 		return err
@@ -114,7 +112,7 @@ type checkoutTag struct {
 	params TagParams
 }
 
-func (c checkoutTag) do(gitCmd git.Git, fetchOptions fetchOptions, fallback fallbackRetry) error {
+func (c checkoutTag) do(gitCmd gitRunner, fetchOptions fetchOptions, fallback fallbackRetry) error {
 	ref := fmt.Sprintf("refs/tags/%s:refs/tags/%s", c.params.Tag, c.params.Tag)
 	if err := fetch(gitCmd, originRemoteName, ref, fetchOptions); err != nil {
 		return err
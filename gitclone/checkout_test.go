@@ -6,7 +6,7 @@ func Test_selectCheckoutMethod(t *testing.T) {
 	tests := []struct {
 		name        string
 		cfg         Config
-		patchSource patchSource
+		patchSource PatchSource
 		want        CheckoutMethod
 	}{
 		{
@@ -245,8 +245,8 @@ func Test_selectCheckoutMethod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got, _ := selectCheckoutMethod(tt.cfg, tt.patchSource); got != tt.want {
-				t.Errorf("selectCheckoutMethod() = %v, want %v", got, tt.want)
+			if got, _ := selectCheckoutMethod(tt.cfg, tt.patchSource, &decisionLog{}, logger{}); got != tt.want {
+				t.Errorf("selectCheckoutMethod(, logger{}) = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,49 @@
+package gitclone
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// cloneFilterAuto lets the Step select the filter based on the checkout method and the sparse-checkout settings
+	cloneFilterAuto = ""
+	// cloneFilterNone disables partial clone
+	cloneFilterNone = "none"
+	// cloneFilterBlobless omits all blobs, they are downloaded on demand (blobless clone)
+	cloneFilterBlobless = "blob:none"
+	// cloneFilterTreeless omits all trees and blobs, they are downloaded on demand (treeless clone)
+	cloneFilterTreeless = "tree:0"
+	// cloneFilterBlobLimitPrefix omits blobs larger than the given size
+	cloneFilterBlobLimitPrefix = "blob:limit="
+)
+
+var blobLimitSizeRegexp = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// parseCloneFilter validates the clone_filter input
+// Valid values: "" (auto), "none", "blob:none", "tree:0", "blob:limit=<n>[kmg]"
+func parseCloneFilter(filter string) (string, error) {
+	filter = strings.TrimSpace(filter)
+
+	switch filter {
+	case cloneFilterAuto, cloneFilterNone, cloneFilterBlobless, cloneFilterTreeless:
+		return filter, nil
+	}
+
+	if strings.HasPrefix(filter, cloneFilterBlobLimitPrefix) {
+		size := strings.TrimPrefix(filter, cloneFilterBlobLimitPrefix)
+		if blobLimitSizeRegexp.MatchString(size) {
+			return filter, nil
+		}
+
+		return "", NewParameterValidationError(fmt.Sprintf("invalid clone filter (%s): blob size limit should be a number with an optional k, m or g unit suffix", filter))
+	}
+
+	return "", NewParameterValidationError(fmt.Sprintf("invalid clone filter (%s): should be one of none, %s, %s or %s<size>", filter, cloneFilterBlobless, cloneFilterTreeless, cloneFilterBlobLimitPrefix))
+}
+
+// isExplicitCloneFilter returns true if a partial clone filter was requested by the user
+func isExplicitCloneFilter(filter string) bool {
+	return filter != cloneFilterAuto && filter != cloneFilterNone
+}
@@ -0,0 +1,38 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseCloneFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    string
+		wantErr bool
+	}{
+		{name: "auto", filter: "", want: ""},
+		{name: "none", filter: "none", want: "none"},
+		{name: "blobless", filter: "blob:none", want: "blob:none"},
+		{name: "treeless", filter: "tree:0", want: "tree:0"},
+		{name: "blob size limit", filter: "blob:limit=512", want: "blob:limit=512"},
+		{name: "blob size limit with unit", filter: " blob:limit=10m ", want: "blob:limit=10m"},
+		{name: "blob size limit without size", filter: "blob:limit=", wantErr: true},
+		{name: "blob size limit with invalid unit", filter: "blob:limit=10mb", wantErr: true},
+		{name: "unknown filter", filter: "tree:1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCloneFilter(tt.filter)
+			if tt.wantErr {
+				assert.IsType(t, ParameterValidationError{}, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package gitclone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CommitInfo is the metadata of the checked out commit
+type CommitInfo struct {
+	Hash           string
+	MessageSubject string
+	MessageBody    string
+	AuthorName     string
+	AuthorEmail    string
+	CommitterName  string
+	CommitterEmail string
+	// Count is the number of commits reachable from the checked out commit, limited by the fetch depth
+	Count int
+}
+
+// Result is the outcome of the clone process
+type Result struct {
+	// CheckoutMethod is the name of the selected checkout method, for example pr_merge_branch
+	CheckoutMethod string
+	// Commit is nil if no commit, tag or branch was checked out
+	Commit *CommitInfo
+	// Signature is nil if the signature verification is off
+	Signature *SignatureInfo
+	// Submodules is nil if the submodules are not updated
+	Submodules []SubmoduleInfo
+	// SubmodulesPath is the path of the JSON submodule state, empty if writing it failed
+	SubmodulesPath string
+	// Phases are the metrics of the phases with at least one command run
+	Phases []PhaseMetrics
+	// ReportPath is the path of the JSON clone report, empty if writing the report failed
+	ReportPath string
+}
+
+type output struct {
+	key   string
+	value string
+}
+
+// outputs returns the Step outputs of the result, in the order of the Step definition
+func (r Result) outputs() []output {
+	var outputs []output
+	if r.Commit != nil {
+		outputs = append(outputs,
+			output{"GIT_CLONE_COMMIT_HASH", r.Commit.Hash},
+			output{"GIT_CLONE_COMMIT_MESSAGE_SUBJECT", r.Commit.MessageSubject},
+			output{"GIT_CLONE_COMMIT_MESSAGE_BODY", r.Commit.MessageBody},
+			output{"GIT_CLONE_COMMIT_COUNT", strconv.Itoa(r.Commit.Count)},
+			output{"GIT_CLONE_COMMIT_AUTHOR_NAME", r.Commit.AuthorName},
+			output{"GIT_CLONE_COMMIT_AUTHOR_EMAIL", r.Commit.AuthorEmail},
+			output{"GIT_CLONE_COMMIT_COMMITER_NAME", r.Commit.CommitterName},
+			output{"GIT_CLONE_COMMIT_COMMITER_EMAIL", r.Commit.CommitterEmail},
+		)
+	}
+
+	if r.Signature != nil {
+		outputs = append(outputs,
+			output{"GIT_CLONE_SIGNATURE_VERIFIED", strconv.FormatBool(r.Signature.Verified)},
+			output{"GIT_CLONE_SIGNER", r.Signature.Signer},
+			output{"GIT_CLONE_SIGNING_KEY", r.Signature.Key},
+		)
+	}
+
+	if r.Submodules != nil {
+		outputs = append(outputs, output{submodulesEnv, submoduleStateJSON(r.Submodules)})
+		if r.SubmodulesPath != "" {
+			outputs = append(outputs, output{submodulesPathEnv, r.SubmodulesPath})
+		}
+	}
+
+	metrics := metricsEnvs(r.Phases)
+	for _, key := range metricsOutputs {
+		outputs = append(outputs, output{key, metrics[key]})
+	}
+
+	if r.ReportPath != "" {
+		outputs = append(outputs, output{reportPathEnv, r.ReportPath})
+	}
+	return outputs
+}
+
+// Cloner runs the git clone process, its dependencies can be replaced by Options
+type Cloner struct {
+	runner   CommandRunner
+	exporter OutputExporter
+	patch    PatchSource
+	output   io.Writer
+	// secrets of the running clone, masked in the log messages and the returned error
+	secrets secrets
+}
+
+// Option configures a Cloner
+type Option func(*Cloner)
+
+// WithRunner sets the runner of the git commands.
+// The timeout and retry configuration only applies to the default runner, and only the default runner masks the tokens of the config in the output of the commands.
+func WithRunner(runner CommandRunner) Option {
+	return func(c *Cloner) {
+		c.runner = runner
+	}
+}
+
+// WithExporter sets the exporter of the outputs, the default exporter is EnvmanExporter
+func WithExporter(exporter OutputExporter) Option {
+	return func(c *Cloner) {
+		c.exporter = exporter
+	}
+}
+
+// WithPatchSource sets the source of the Pull Request diff file, by default it is downloaded from the Bitrise build
+func WithPatchSource(patch PatchSource) Option {
+	return func(c *Cloner) {
+		c.patch = patch
+	}
+}
+
+// WithLogOutput redirects the log messages of the Cloner, the EnvmanExporter and the output of the commands, which are written to stdout and stderr by default.
+// The output of a runner set by WithRunner is not redirected.
+func WithLogOutput(w io.Writer) Option {
+	return func(c *Cloner) {
+		c.output = w
+	}
+}
+
+// NewCloner returns a Cloner with the default dependencies, replaced by the given options
+func NewCloner(opts ...Option) *Cloner {
+	c := &Cloner{
+		exporter: EnvmanExporter{},
+		patch:    defaultPatchSource{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if exporter, ok := c.exporter.(EnvmanExporter); ok && exporter.Output == nil {
+		exporter.Output = c.output
+		c.exporter = exporter
+	}
+	return c
+}
+
+// Clone runs the git clone process, and exports the outputs.
+// The result is partially filled if the process fails.
+// A Cloner runs one clone at a time, the concurrent clones need their own Cloners.
+func (c *Cloner) Clone(cfg Config) (Result, error) {
+	c.secrets = nil
+
+	var result Result
+	err := c.checkout(cfg, &result)
+	// The secrets are collected by the checkout
+	err = c.secrets.redactError(err)
+	if cfg.DryRun {
+		return result, err
+	}
+
+	if eErr := c.export(result); eErr != nil {
+		if err != nil {
+			c.log().Warnf("%v", eErr)
+			return result, err
+		}
+		return result, eErr
+	}
+	return result, err
+}
+
+// log returns the logger of the clone process, printing to the log output of the Cloner
+func (c *Cloner) log() logger {
+	return logger{w: c.output, secrets: c.secrets}
+}
+
+func (c *Cloner) export(result Result) error {
+	c.log().Infof("\nExporting outputs\n")
+	for _, o := range result.outputs() {
+		c.log().Printf("=> %s\n   value: %s\n", o.key, o.value)
+		if err := c.exporter.ExportOutput(o.key, o.value); err != nil {
+			switch {
+			case errors.Is(err, errMaxEnvLength):
+				return newStepError(
+					"get_max_commit_msg_length_failed",
+					fmt.Errorf("failed to set commit message length: %v", err),
+					"Getting allowed commit message length failed",
+				)
+			case o.key == "GIT_CLONE_COMMIT_COUNT":
+				return newStepError(
+					"export_envs_commit_count_failed",
+					fmt.Errorf("envman export failed: %v", err),
+					"Exporting commit count env failed",
+				)
+			}
+			return newStepError(
+				"export_envs_failed",
+				fmt.Errorf("exporting output (%s) failed: %v", o.key, err),
+				"Exporting envs failed",
+			)
+		}
+	}
+	return nil
+}
+
+func readCommitInfo(gitCmd gitRunner) (*CommitInfo, error) {
+	commit := &CommitInfo{}
+	for _, field := range []struct {
+		format string
+		value  *string
+	}{
+		{`%H`, &commit.Hash},
+		{`%s`, &commit.MessageSubject},
+		{`%b`, &commit.MessageBody},
+		{`%an`, &commit.AuthorName},
+		{`%ae`, &commit.AuthorEmail},
+		{`%cn`, &commit.CommitterName},
+		{`%ce`, &commit.CommitterEmail},
+	} {
+		out, err := gitCmd.runner.RunForOutput(gitCmd.Log(field.format))
+		if err != nil {
+			return nil, newStepError(
+				"export_envs_failed",
+				fmt.Errorf("gitCmd log failed: %v", err),
+				"Exporting envs failed",
+			)
+		}
+		*field.value = out
+	}
+
+	out, err := gitCmd.runner.RunForOutput(gitCmd.RevList("HEAD", "--count"))
+	if err != nil {
+		return nil, newStepError(
+			"count_commits_failed",
+			fmt.Errorf("get rev-list failed: %v", err),
+			"Counting commits failed",
+		)
+	}
+	if commit.Count, err = strconv.Atoi(out); err != nil {
+		return nil, newStepError(
+			"count_commits_failed",
+			fmt.Errorf("invalid rev-list count (%s): %v", out, err),
+			"Counting commits failed",
+		)
+	}
+
+	return commit, nil
+}
@@ -0,0 +1,202 @@
+package gitclone
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-init/step"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/assert"
+)
+
+// outputRunner succeeds for every command, and returns the configured output of the commands run for output
+type outputRunner struct {
+	outputs map[string]string
+	cmds    []string
+}
+
+func (r *outputRunner) RunForOutput(c *command.Model) (string, error) {
+	r.cmds = append(r.cmds, c.PrintableCommandArgs())
+	return r.outputs[c.PrintableCommandArgs()], nil
+}
+
+func (r *outputRunner) Run(c *command.Model) error {
+	r.cmds = append(r.cmds, c.PrintableCommandArgs())
+	return nil
+}
+
+func (r *outputRunner) RunWithRetry(getCommand func() *command.Model) error {
+	return r.Run(getCommand())
+}
+
+type recordingExporter struct {
+	outputs map[string]string
+	err     error
+}
+
+func (e *recordingExporter) ExportOutput(key, value string) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.outputs[key] = value
+	return nil
+}
+
+func Test_Cloner_Clone(t *testing.T) {
+	// Given
+	testRunner := &outputRunner{outputs: map[string]string{
+		`git "log" "-1" "--format=%H"`:    "76a934ae80f12bb9b504bbc86f64a1d310e5db64",
+		`git "log" "-1" "--format=%s"`:    "Subject",
+		`git "log" "-1" "--format=%b"`:    "Body",
+		`git "log" "-1" "--format=%an"`:   "Author",
+		`git "log" "-1" "--format=%ae"`:   "author@example.com",
+		`git "log" "-1" "--format=%cn"`:   "Committer",
+		`git "log" "-1" "--format=%ce"`:   "committer@example.com",
+		`git "rev-list" "HEAD" "--count"`: "1",
+	}}
+	exporter := &recordingExporter{outputs: map[string]string{}}
+	var logs bytes.Buffer
+	cloner := NewCloner(WithRunner(testRunner), WithExporter(exporter), WithLogOutput(&logs))
+	cfg := Config{
+		RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git",
+		CloneIntoDir:  t.TempDir(),
+		Commit:        "76a934ae",
+		CloneDepth:    1,
+	}
+
+	// When
+	result, err := cloner.Clone(cfg)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", result.CheckoutMethod)
+	assert.Equal(t, &CommitInfo{
+		Hash:           "76a934ae80f12bb9b504bbc86f64a1d310e5db64",
+		MessageSubject: "Subject",
+		MessageBody:    "Body",
+		AuthorName:     "Author",
+		AuthorEmail:    "author@example.com",
+		CommitterName:  "Committer",
+		CommitterEmail: "committer@example.com",
+		Count:          1,
+	}, result.Commit)
+	assert.NotEmpty(t, result.ReportPath)
+	assert.Contains(t, testRunner.cmds, `git "checkout" "76a934ae"`)
+
+	assert.Equal(t, "76a934ae80f12bb9b504bbc86f64a1d310e5db64", exporter.outputs["GIT_CLONE_COMMIT_HASH"])
+	assert.Equal(t, "1", exporter.outputs["GIT_CLONE_COMMIT_COUNT"])
+	assert.Equal(t, result.ReportPath, exporter.outputs["GIT_CLONE_REPORT_PATH"])
+	assert.Contains(t, exporter.outputs, "GIT_CLONE_TOTAL_DURATION_MS")
+	assert.NotContains(t, exporter.outputs, "GIT_CLONE_OTHER_DURATION_MS", "only the outputs of the Step definition should be exported")
+
+	assert.Contains(t, logs.String(), "Exporting outputs", "the log output should be redirected")
+}
+
+func Test_Cloner_Clone_exportFails(t *testing.T) {
+	// Given
+	cloner := NewCloner(
+		WithRunner(&outputRunner{outputs: map[string]string{`git "rev-list" "HEAD" "--count"`: "1"}}),
+		WithExporter(&recordingExporter{err: errors.New("export failed")}),
+		WithLogOutput(&bytes.Buffer{}),
+	)
+	cfg := Config{
+		RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git",
+		CloneIntoDir:  t.TempDir(),
+		Branch:        "master",
+	}
+
+	// When
+	result, err := cloner.Clone(cfg)
+
+	// Then
+	assert.EqualError(t, err, "exporting output (GIT_CLONE_COMMIT_HASH) failed: export failed")
+	assert.Equal(t, "branch", result.CheckoutMethod)
+	assert.NotNil(t, result.Commit)
+}
+
+func Test_Cloner_export_errorTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		result  Result
+		wantTag string
+	}{
+		{
+			name:    "commit message length",
+			err:     fmt.Errorf("%w: envman config", errMaxEnvLength),
+			result:  Result{Commit: &CommitInfo{}},
+			wantTag: "get_max_commit_msg_length_failed",
+		},
+		{
+			name:    "commit hash",
+			err:     errors.New("export failed"),
+			result:  Result{Commit: &CommitInfo{}},
+			wantTag: "export_envs_failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloner := NewCloner(WithExporter(&recordingExporter{err: tt.err}), WithLogOutput(&bytes.Buffer{}))
+
+			err := cloner.export(tt.result)
+
+			var stepErr *step.Error
+			assert.True(t, errors.As(err, &stepErr))
+			assert.Equal(t, tt.wantTag, stepErr.Tag)
+		})
+	}
+}
+
+func Test_Cloner_export_commitCountErrorTag(t *testing.T) {
+	exporter := &failingKeyExporter{key: "GIT_CLONE_COMMIT_COUNT"}
+	cloner := NewCloner(WithExporter(exporter), WithLogOutput(&bytes.Buffer{}))
+
+	err := cloner.export(Result{Commit: &CommitInfo{}})
+
+	var stepErr *step.Error
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "export_envs_commit_count_failed", stepErr.Tag)
+}
+
+// failingKeyExporter fails to export the given key
+type failingKeyExporter struct {
+	key string
+}
+
+func (e *failingKeyExporter) ExportOutput(key, value string) error {
+	if key == e.key {
+		return errors.New("export failed")
+	}
+	return nil
+}
+
+func Test_NewCloner_envmanExporterLogOutput(t *testing.T) {
+	var logs bytes.Buffer
+
+	assert.Equal(t, EnvmanExporter{Output: &logs}, NewCloner(WithLogOutput(&logs)).exporter)
+	assert.Equal(t, EnvmanExporter{Output: &logs}, NewCloner(WithExporter(EnvmanExporter{}), WithLogOutput(&logs)).exporter)
+}
+
+func Test_Cloner_Clone_secrets(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	cloner := NewCloner(WithRunner(&outputRunner{}), WithExporter(&recordingExporter{outputs: map[string]string{}}), WithLogOutput(&logs))
+	cfg := Config{
+		RepositoryURL:   "https://github.com/bitrise-io/git-clone-test.git",
+		CloneIntoDir:    t.TempDir(),
+		GitHTTPUsername: "user",
+		GitHTTPToken:    "s3cr3t-http-token",
+		DryRun:          true,
+	}
+
+	// When
+	_, err := cloner.Clone(cfg)
+	cloner.log().Printf("token: s3cr3t-http-token")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "token: [REDACTED]")
+	assert.Equal(t, "s3cr3t-http-token", Redact("s3cr3t-http-token"), "the secrets of the Cloner should not be masked globally")
+}
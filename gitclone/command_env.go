@@ -0,0 +1,119 @@
+package gitclone
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+// The config passed in the environment (GIT_CONFIG_COUNT) is supported since git 2.31, older versions ignore it
+const (
+	gitConfigEnvMinMajor = 2
+	gitConfigEnvMinMinor = 31
+)
+
+var gitVersionRegexp = regexp.MustCompile(`git version (\d+)\.(\d+)`)
+
+// commandEnv extends the environment of the git commands
+type commandEnv interface {
+	envs(env []string) []string
+}
+
+// gitConfigEntry is a config key and value passed to git in the environment
+type gitConfigEntry struct {
+	key   string
+	value string
+}
+
+func envValue(env []string, key string) string {
+	value := ""
+	for _, e := range env {
+		if v := strings.TrimPrefix(e, key+"="); v != e {
+			value = v
+		}
+	}
+	return value
+}
+
+// withGitConfig returns the environment extended with the config entries through the GIT_CONFIG_COUNT,
+// GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n> env vars. The config is inherited by the child git processes too
+// (like the submodule clones), but it is not written to any config file.
+func withGitConfig(env []string, config []gitConfigEntry) []string {
+	extended := append([]string{}, env...)
+	if len(config) == 0 {
+		return extended
+	}
+
+	// Keep the config passed in the environment by the user or by another commandEnv
+	count := 0
+	if n, err := strconv.Atoi(envValue(env, "GIT_CONFIG_COUNT")); err == nil {
+		count = n
+	}
+
+	for _, entry := range config {
+		extended = append(extended,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, entry.key),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, entry.value),
+		)
+		count++
+	}
+
+	return append(extended, "GIT_CONFIG_COUNT="+strconv.Itoa(count))
+}
+
+// checkGitConfigEnvSupport returns an error if the git version (the output of git --version) does not support
+// the config passed in the environment. An unknown version is accepted.
+func checkGitConfigEnvSupport(versionOutput string, log logger) error {
+	match := gitVersionRegexp.FindStringSubmatch(versionOutput)
+	if match == nil {
+		log.Warnf("Failed to parse the git version (%s), git %d.%d or later is required", versionOutput, gitConfigEnvMinMajor, gitConfigEnvMinMinor)
+		return nil
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	if major < gitConfigEnvMinMajor || major == gitConfigEnvMinMajor && minor < gitConfigEnvMinMinor {
+		return fmt.Errorf("git %d.%d or later is required for the credentials and the URL rewrite rules, the installed version is %s.%s",
+			gitConfigEnvMinMajor, gitConfigEnvMinMinor, match[1], match[2])
+	}
+	return nil
+}
+
+// envRunner extends the environment of every command run through the wrapped CommandRunner
+type envRunner struct {
+	runner CommandRunner
+	envs   []commandEnv
+}
+
+func (r envRunner) apply(c *command.Model) *command.Model {
+	env := c.GetCmd().Env
+	if env == nil {
+		env = os.Environ()
+	}
+	for _, e := range r.envs {
+		env = e.envs(env)
+	}
+
+	return c.SetEnvs(env...)
+}
+
+// RunForOutput ...
+func (r envRunner) RunForOutput(c *command.Model) (string, error) {
+	return r.runner.RunForOutput(r.apply(c))
+}
+
+// Run ...
+func (r envRunner) Run(c *command.Model) error {
+	return r.runner.Run(r.apply(c))
+}
+
+// RunWithRetry ...
+func (r envRunner) RunWithRetry(getCommand func() *command.Model) error {
+	return r.runner.RunWithRetry(func() *command.Model {
+		return r.apply(getCommand())
+	})
+}
@@ -5,13 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/errorutil"
-	"github.com/bitrise-io/go-utils/log"
-	"github.com/bitrise-io/go-utils/retry"
 )
 
 // CommandRunner ...
@@ -21,17 +20,103 @@ type CommandRunner interface {
 	RunWithRetry(getCommmand func() *command.Model) error
 }
 
+// exitStatusError is returned when a command exits with a non-zero status, its message is the command's output
+type exitStatusError struct {
+	output   string
+	exitCode int
+}
+
+// Error ...
+func (e exitStatusError) Error() string {
+	return e.output
+}
+
+func newExitStatusError(output string, err error) error {
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+
+	return exitStatusError{
+		output:   output,
+		exitCode: exitCode,
+	}
+}
+
+// exitCode returns the exit code of the command from the error returned by a CommandRunner,
+// or -1 if the command did not exit normally
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr exitStatusError
+	if errors.As(err, &exitErr) {
+		return exitErr.exitCode
+	}
+
+	return -1
+}
+
 // DefaultRunner ...
+// A writer set as the stderr of the command (for example by a wrapping CommandRunner) receives the command's stderr too.
 type DefaultRunner struct {
+	// Timeout is the maximum duration of a single command run, 0 means no timeout
+	Timeout time.Duration
+	// StallTimeout is the maximum duration a command reporting its progress (see streamsProgress) may run
+	// without writing any output, 0 means no stall detection
+	StallTimeout time.Duration
+	// Retry is the retry policy of RunWithRetry
+	Retry RetryPolicy
+	// Output receives the log messages and the output of the commands, they are written to stdout and stderr if nil
+	Output io.Writer
+	// Secrets are masked in the logged commands, the output of the commands and the returned errors,
+	// on top of the credentials masked by Redact
+	Secrets []string
+}
+
+func (r DefaultRunner) log() logger {
+	return logger{w: r.Output, secrets: r.Secrets}
+}
+
+func (r DefaultRunner) run(c *command.Model) error {
+	cmd := c.GetCmd()
+	stallTimeout := r.StallTimeout
+	if !streamsProgress(cmd.Args) {
+		stallTimeout = 0
+	}
+	return runWithTimeouts(cmd, r.Timeout, stallTimeout)
+}
+
+// teeStderr returns the writer of the command's stderr, extended by the writer already set as the command's stderr
+func teeStderr(c *command.Model, w io.Writer) io.Writer {
+	if preset := c.GetCmd().Stderr; preset != nil {
+		return io.MultiWriter(w, preset)
+	}
+	return w
 }
 
 // RunForOutput ...
 func (r DefaultRunner) RunForOutput(c *command.Model) (string, error) {
-	log.Infof("$ %s &> out", c.PrintableCommandArgs())
+	redactor := secrets(r.Secrets)
+	r.log().Infof("$ %s &> out", redactor.redact(c.PrintableCommandArgs()))
+
+	var buffer bytes.Buffer
+	c.SetStdout(&buffer).SetStderr(teeStderr(c, &buffer))
+
+	err := r.run(c)
+	out := strings.TrimSpace(buffer.String())
+	if err != nil {
+		if errorutil.IsExitStatusError(err) {
+			return out, newExitStatusError(redactor.redact(out), err)
+		}
 
-	out, err := c.RunAndReturnTrimmedCombinedOutput()
-	if err != nil && errorutil.IsExitStatusError(err) {
-		return out, errors.New(out)
+		var timeoutErr commandTimeoutError
+		if errors.As(err, &timeoutErr) {
+			timeoutErr.output = redactor.redact(out)
+			return out, timeoutErr
+		}
 	}
 
 	return out, err
@@ -39,14 +124,29 @@ func (r DefaultRunner) RunForOutput(c *command.Model) (string, error) {
 
 // Run ...
 func (r DefaultRunner) Run(c *command.Model) error {
-	fmt.Println()
-	log.Infof("$ %s", c.PrintableCommandArgs())
+	logger := r.log()
+	redactor := secrets(r.Secrets)
+	fmt.Fprintln(logger.stdout())
+	logger.Infof("$ %s", redactor.redact(c.PrintableCommandArgs()))
 	var buffer bytes.Buffer
+	// The progress updates are parsed by a writer set as the command's stderr (see metricsRunner), they are not written to the log
+	stderr := &progressFilter{w: logger.stderr()}
 
-	err := c.SetStdout(os.Stdout).SetStderr(io.MultiWriter(os.Stderr, &buffer)).Run()
+	// The writers are pointers, as runWithTimeouts compares the stdout and stderr writers
+	c.SetStdout(&redactingWriter{w: logger.stdout(), secrets: redactor}).SetStderr(teeStderr(c, &redactingWriter{w: io.MultiWriter(stderr, &buffer), secrets: redactor}))
+	err := r.run(c)
+	if fErr := stderr.flush(); fErr != nil {
+		logger.Warnf("Failed to write the command output: %v", fErr)
+	}
 	if err != nil {
 		if errorutil.IsExitStatusError(err) {
-			return errors.New(strings.TrimSpace(buffer.String()))
+			return newExitStatusError(strings.TrimSpace(stripProgress(buffer.String())), err)
+		}
+
+		var timeoutErr commandTimeoutError
+		if errors.As(err, &timeoutErr) {
+			timeoutErr.output = strings.TrimSpace(stripProgress(buffer.String()))
+			return timeoutErr
 		}
 		return err
 	}
@@ -56,17 +156,28 @@ func (r DefaultRunner) Run(c *command.Model) error {
 
 // RunWithRetry ...
 func (r DefaultRunner) RunWithRetry(getCommand func() *command.Model) error {
-	return retry.Times(2).Wait(5).Try(func(attempt uint) error {
+	logger := r.log()
+	for attempt := uint(0); ; attempt++ {
 		if attempt > 0 {
-			log.Warnf("Retrying...")
+			wait := r.Retry.waitBefore(attempt)
+			logger.Warnf("Retrying in %s...", wait)
+			time.Sleep(wait)
 		}
 
 		err := r.Run(getCommand())
-		if err != nil {
-			log.Warnf("Attempt %d failed:", attempt+1)
-			fmt.Println(err.Error())
+		if err == nil {
+			return nil
 		}
 
-		return err
-	})
+		logger.Warnf("Attempt %d failed:", attempt+1)
+		fmt.Fprintln(logger.stdout(), secrets(r.Secrets).redact(err.Error()))
+
+		if attempt >= r.Retry.Retries {
+			return err
+		}
+		if !isRetryableError(err) {
+			logger.Warnf("The error is not temporary, not retrying")
+			return err
+		}
+	}
 }
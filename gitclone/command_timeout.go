@@ -0,0 +1,188 @@
+package gitclone
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// killWaitDelay is the maximum duration to wait for a killed command to exit
+const killWaitDelay = 10 * time.Second
+
+// commandTimeoutError is returned when a command is killed, as it did not finish in time
+// or did not produce any output for too long (stalled)
+type commandTimeoutError struct {
+	stalled bool
+	timeout time.Duration
+	// output is the error output of the command until it was killed
+	output string
+}
+
+// Error ...
+func (e commandTimeoutError) Error() string {
+	msg := fmt.Sprintf("command timed out after %s and was killed", e.timeout)
+	if e.stalled {
+		msg = fmt.Sprintf("command stalled (no output for %s) and was killed", e.timeout)
+	}
+
+	if e.output != "" {
+		return msg + ":\n" + e.output
+	}
+	return msg
+}
+
+// tag returns the step error tag of the timed out operation (for example fetch_stalled or fetch_timed_out)
+func (e commandTimeoutError) tag(operation string) string {
+	if e.stalled {
+		return operation + "_stalled"
+	}
+	return operation + "_timed_out"
+}
+
+// activityWriter records the time of the last write
+type activityWriter struct {
+	w            io.Writer
+	lastActivity *int64
+}
+
+func (a activityWriter) Write(p []byte) (int, error) {
+	atomic.StoreInt64(a.lastActivity, time.Now().UnixNano())
+	return a.w.Write(p)
+}
+
+// streamsProgress returns if the command reports its progress continuously,
+// the other commands (like checkout fetching missing blobs) may be silent for a long time and are not checked for stalls.
+func streamsProgress(args []string) bool {
+	for _, arg := range args {
+		if arg == "--progress" {
+			return true
+		}
+	}
+	return false
+}
+
+// waitAfterKill waits for the killed command to exit. The command's output pipes may be kept open by a child process
+// which is not killed (like ssh on Windows), so it does not wait longer than killWaitDelay.
+func waitAfterKill(done <-chan error) {
+	timer := time.NewTimer(killWaitDelay)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
+
+func stallCheckInterval(stallTimeout time.Duration) time.Duration {
+	if interval := stallTimeout / 4; interval < time.Second {
+		return interval
+	}
+	return time.Second
+}
+
+// runWithTimeouts runs the command, and kills it (with its child processes, like ssh) if it does not finish within timeout,
+// or does not write to its stdout or stderr for stallTimeout. A zero timeout disables the given check.
+func runWithTimeouts(cmd *exec.Cmd, timeout, stallTimeout time.Duration) error {
+	if timeout <= 0 && stallTimeout <= 0 {
+		return cmd.Run()
+	}
+
+	lastActivity := time.Now().UnixNano()
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	if stdout != nil {
+		cmd.Stdout = activityWriter{w: stdout, lastActivity: &lastActivity}
+	}
+	if stderr != nil {
+		if stderr == stdout {
+			// exec.Cmd copies the output with a single goroutine only if stdout and stderr are the same writer
+			cmd.Stderr = cmd.Stdout
+		} else {
+			cmd.Stderr = activityWriter{w: stderr, lastActivity: &lastActivity}
+		}
+	}
+
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeoutC, stallCheckC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	if stallTimeout > 0 {
+		ticker := time.NewTicker(stallCheckInterval(stallTimeout))
+		defer ticker.Stop()
+		stallCheckC = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-timeoutC:
+			killProcessGroup(cmd)
+			waitAfterKill(done)
+			return commandTimeoutError{timeout: timeout}
+		case <-stallCheckC:
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&lastActivity)))
+			if idle >= stallTimeout {
+				killProcessGroup(cmd)
+				waitAfterKill(done)
+				return commandTimeoutError{stalled: true, timeout: stallTimeout}
+			}
+		}
+	}
+}
+
+var progressLineRegexp = regexp.MustCompile(`[^\n]*\r`)
+
+// stripProgress removes the progress updates (terminated by carriage return) from git's output
+func stripProgress(output string) string {
+	return progressLineRegexp.ReplaceAllString(output, "")
+}
+
+// progressFilter drops the progress updates (terminated by carriage return) from the written output,
+// the other lines are written to the wrapped writer once they are complete.
+type progressFilter struct {
+	w    io.Writer
+	line []byte
+}
+
+func (f *progressFilter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch b {
+		case '\r':
+			f.line = f.line[:0]
+		case '\n':
+			f.line = append(f.line, b)
+			if err := f.flush(); err != nil {
+				return 0, err
+			}
+		default:
+			f.line = append(f.line, b)
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the incomplete last line
+func (f *progressFilter) flush() error {
+	if len(f.line) == 0 {
+		return nil
+	}
+
+	_, err := f.w.Write(f.line)
+	f.line = f.line[:0]
+	return err
+}
@@ -0,0 +1,152 @@
+package gitclone
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-init/step"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_DefaultRunner_Timeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		runner      DefaultRunner
+		script      string
+		args        []string
+		wantErr     bool
+		wantTimeout bool
+		wantStalled bool
+	}{
+		{
+			name:   "no timeouts",
+			runner: DefaultRunner{},
+			script: "echo done",
+		},
+		{
+			name:   "finishes within timeout",
+			runner: DefaultRunner{Timeout: 5 * time.Second},
+			script: "echo done",
+		},
+		{
+			name:        "timed out",
+			runner:      DefaultRunner{Timeout: 200 * time.Millisecond},
+			script:      "sleep 5",
+			wantErr:     true,
+			wantTimeout: true,
+		},
+		{
+			name:        "stalled",
+			runner:      DefaultRunner{StallTimeout: 300 * time.Millisecond},
+			script:      "echo started >&2; sleep 5",
+			args:        []string{"--progress"},
+			wantErr:     true,
+			wantTimeout: true,
+			wantStalled: true,
+		},
+		{
+			name:   "progress output is not stalled",
+			runner: DefaultRunner{StallTimeout: 400 * time.Millisecond},
+			script: "for i in 1 2 3 4 5; do echo $i >&2; sleep 0.1; done",
+			args:   []string{"--progress"},
+		},
+		{
+			name:   "command without progress is not checked for stalls",
+			runner: DefaultRunner{StallTimeout: 200 * time.Millisecond},
+			script: "echo started >&2; sleep 0.5",
+		},
+		{
+			name:    "failure is not a timeout",
+			runner:  DefaultRunner{Timeout: 5 * time.Second, StallTimeout: 5 * time.Second},
+			script:  "echo failed >&2; exit 3",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			// The args are passed to the script as positional parameters
+			err := tt.runner.Run(command.New("sh", append([]string{"-c", tt.script, "sh"}, tt.args...)...))
+
+			assert.True(t, time.Since(start) < 4*time.Second, "the command should have been killed")
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+
+			var timeoutErr commandTimeoutError
+			assert.Equal(t, tt.wantTimeout, errors.As(err, &timeoutErr))
+			assert.Equal(t, tt.wantStalled, timeoutErr.stalled)
+		})
+	}
+}
+
+func Test_DefaultRunner_RunForOutput_Timeout(t *testing.T) {
+	r := DefaultRunner{Timeout: 200 * time.Millisecond}
+	out, err := r.RunForOutput(command.New("sh", "-c", "echo partial; sleep 5"))
+
+	var timeoutErr commandTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, "partial", out)
+	assert.Equal(t, "partial", timeoutErr.output)
+	assert.Equal(t, "fetch_timed_out", timeoutErr.tag("fetch"))
+}
+
+func Test_stripProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "no progress",
+			output: "fatal: could not read from remote repository\n",
+			want:   "fatal: could not read from remote repository\n",
+		},
+		{
+			name:   "progress lines",
+			output: "Receiving objects:  10% (1/10)\rReceiving objects: 100% (10/10), done.\nfatal: early EOF\n",
+			want:   "Receiving objects: 100% (10/10), done.\nfatal: early EOF\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stripProgress(tt.output))
+		})
+	}
+}
+
+func Test_progressFilter(t *testing.T) {
+	// Given
+	var output bytes.Buffer
+	filter := &progressFilter{w: &output}
+
+	// When
+	for _, chunk := range []string{"Receiving objects:  10% (1/10)\rReceiving", " objects: 100% (10/10), done.\nfatal: ", "early EOF"} {
+		_, err := filter.Write([]byte(chunk))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, filter.flush())
+
+	// Then
+	assert.Equal(t, "Receiving objects: 100% (10/10), done.\nfatal: early EOF", output.String())
+}
+
+func Test_unshallowFetch_timeout(t *testing.T) {
+	// Given
+	mockRunner := new(MockRunner)
+	mockRunner.On("RunWithRetry", mock.Anything).Return(commandTimeoutError{stalled: true, timeout: time.Minute})
+
+	// When
+	err := unshallowFetch(gitRunner{runner: mockRunner}, unshallowFetchOptions{progress: true})
+
+	// Then
+	var stepErr *step.Error
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "fetch_stalled", stepErr.Tag)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package gitclone
+
+import "os/exec"
+
+func setProcessGroup(_ *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
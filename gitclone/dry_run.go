@@ -0,0 +1,141 @@
+package gitclone
+
+import (
+	"fmt"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+// recordingRunner records the commands instead of running them, every command succeeds without output
+type recordingRunner struct {
+	cmds []string
+}
+
+// RunForOutput ...
+func (r *recordingRunner) RunForOutput(c *command.Model) (string, error) {
+	r.cmds = append(r.cmds, c.PrintableCommandArgs())
+	return "", nil
+}
+
+// Run ...
+func (r *recordingRunner) Run(c *command.Model) error {
+	r.cmds = append(r.cmds, c.PrintableCommandArgs())
+	return nil
+}
+
+// RunWithRetry ...
+func (r *recordingRunner) RunWithRetry(getCommand func() *command.Model) error {
+	return r.Run(getCommand())
+}
+
+// dryRunPatchSource assumes the diff file is available, without downloading it
+type dryRunPatchSource struct{}
+
+func (dryRunPatchSource) DiffPath(buildURL, _ string) (string, error) {
+	return buildURL + "/diff.txt", nil
+}
+
+// checkoutPlan is the result of a dry run
+type checkoutPlan struct {
+	report *cloneReport
+	// cmds are the git commands which would be run if every command succeeded
+	cmds []string
+	// notes are the steps not represented by git commands
+	notes []string
+}
+
+// planCheckout selects the checkout method, strategy, fetch options and fallbacks as Execute does,
+// and records the git commands instead of running them. Neither the network nor the clone directory is touched.
+func planCheckout(cfg Config, log logger) (checkoutPlan, error) {
+	recorder := &recordingRunner{}
+	plan := checkoutPlan{report: newCloneReport()}
+	// Commands are recorded without their working directory
+	gitCmd := gitRunner{runner: recorder, log: log}
+
+	if err := gitCmd.runner.Run(gitCmd.Init()); err != nil {
+		return plan, err
+	}
+	if err := gitCmd.runner.Run(gitCmd.RemoteAdd(originRemoteName, cfg.RepositoryURL)); err != nil {
+		return plan, err
+	}
+
+	if cfg.ReferenceRepository != "" {
+		plan.notes = append(plan.notes, fmt.Sprintf("borrow objects from the reference repository (%s)", cfg.ReferenceRepository))
+	}
+	if cfg.SeedBundle != "" {
+		plan.notes = append(plan.notes, fmt.Sprintf("seed the repository from the bundle (%s) if it is usable", cfg.SeedBundle))
+	}
+	if cfg.UpdateSubmodules && (len(cfg.SubmodulePaths) != 0 || len(cfg.SubmoduleExclude) != 0 || len(cfg.SparseDirectories) != 0) {
+		plan.notes = append(plan.notes, "only the selected submodules of .gitmodules are updated")
+	}
+	if cfg.UpdateSubmodules && cfg.SubmoduleUpdateMode == submoduleRemote {
+		plan.notes = append(plan.notes, "the submodules are checked out at the tip of their tracked branches")
+	}
+	if cfg.BuildURL != "" {
+		plan.notes = append(plan.notes, "the Pull Request diff file is assumed to be available")
+	}
+
+	if cfg.SparseSpecFile != "" {
+		plan.notes = append(plan.notes, fmt.Sprintf("the sparse-checkout patterns of %s are applied after checkout", cfg.SparseSpecFile))
+	}
+	if err := setupSparseCheckout(gitCmd, cfg); err != nil {
+		return plan, err
+	}
+	if err := checkoutState(gitCmd, cfg, dryRunPatchSource{}, plan.report); err != nil {
+		return plan, err
+	}
+	if cfg.UpdateSubmodules {
+		// The submodule commits moved by the remote update mode are only known after the update
+		if err := runSubmoduleUpdate(gitCmd, cfg); err != nil {
+			return plan, err
+		}
+	}
+
+	if cfg.VerifySignature == signatureWarn || cfg.VerifySignature == signatureRequire {
+		verb, object := signedObject(cfg, plan.report.CheckoutMethod)
+		plan.notes = append(plan.notes, fmt.Sprintf("%s %s against the trusted keys (%s)", verb, object, cfg.VerifySignature))
+	}
+
+	plan.cmds = recorder.cmds
+	return plan, nil
+}
+
+func (p checkoutPlan) print(log logger) {
+	fmt.Fprintln(log.stdout())
+	log.Infof("Checkout plan (dry run)")
+	log.Printf("Checkout method: %s", p.report.CheckoutMethod)
+	log.Printf("Checkout strategy: %s", p.report.CheckoutStrategy)
+	log.Printf("Fetch depth: %d", p.report.Depth)
+	if p.report.Filter != "" {
+		log.Printf("Fetch filter: %s", p.report.Filter)
+	}
+	if p.report.Fallback != "" {
+		log.Printf("Fallback on failure: %s", p.report.Fallback)
+	} else {
+		log.Printf("Fallback on failure: none")
+	}
+	for _, note := range p.notes {
+		log.Printf("Note: %s", note)
+	}
+
+	fmt.Fprintln(log.stdout())
+	log.Infof("Commands which would be run:")
+	for i, cmd := range p.cmds {
+		log.Printf("%d. %s", i+1, Redact(cmd))
+	}
+}
+
+func dryRun(cfg Config, result *Result, log logger) error {
+	plan, err := planCheckout(cfg, log)
+	result.CheckoutMethod = plan.report.CheckoutMethod
+	if err != nil {
+		return newStepError(
+			"dry_run_failed",
+			fmt.Errorf("planning checkout failed: %v", err),
+			"Planning checkout failed",
+		)
+	}
+
+	plan.print(log)
+	return nil
+}
@@ -0,0 +1,71 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_planCheckout(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Config
+		wantMethod   string
+		wantFallback string
+		wantCmds     []string
+	}{
+		{
+			name: "commit",
+			cfg: Config{
+				RepositoryURL: "https://github.com/bitrise-io/git-clone-test.git",
+				Commit:        "76a934ae",
+				CloneDepth:    1,
+			},
+			wantMethod:   "commit",
+			wantFallback: "simpleUnshallow",
+			wantCmds: []string{
+				`git "init"`,
+				`git "remote" "add" "origin" "https://github.com/bitrise-io/git-clone-test.git"`,
+				`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress"`,
+				`git "checkout" "76a934ae"`,
+			},
+		},
+		{
+			name: "PR merge branch with submodules",
+			cfg: Config{
+				RepositoryURL:    "https://github.com/bitrise-io/git-clone-test.git",
+				Commit:           "76a934ae",
+				Branch:           "test/commit-messages",
+				PRDestBranch:     "master",
+				PRMergeBranch:    "pull/7/merge",
+				ShouldMergePR:    true,
+				UpdateSubmodules: true,
+			},
+			wantMethod:   "pr_merge_branch",
+			wantFallback: "",
+			wantCmds: []string{
+				`git "init"`,
+				`git "remote" "add" "origin" "https://github.com/bitrise-io/git-clone-test.git"`,
+				`git "fetch" "--jobs=10" "--no-tags" "--progress" "origin" "refs/heads/master"`,
+				`git "fetch" "--jobs=10" "--no-tags" "--progress" "origin" "refs/pull/7/head:pull/7"`,
+				`git "checkout" "master"`,
+				`git "merge" "origin/master"`,
+				`git "merge" "pull/7"`,
+				`git "checkout" "--detach"`,
+				`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// When
+			plan, err := planCheckout(tt.cfg, logger{})
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMethod, plan.report.CheckoutMethod)
+			assert.Equal(t, tt.wantFallback, plan.report.Fallback)
+			assert.Equal(t, tt.wantCmds, plan.cmds)
+		})
+	}
+}
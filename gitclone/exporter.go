@@ -0,0 +1,192 @@
+package gitclone
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/envman/envman"
+	"github.com/bitrise-io/go-steputils/tools"
+)
+
+const trimEnding = "..."
+
+// OutputExporter exports the outputs of the clone process, for example as env vars of the following Steps
+type OutputExporter interface {
+	ExportOutput(key, value string) error
+}
+
+// errMaxEnvLength is returned if the env var size limit of envman can not be read
+var errMaxEnvLength = errors.New("failed to get the maximum env variable size")
+
+// trimmedOutputs are trimmed by EnvmanExporter if they are bigger than the env var size limit of envman
+var trimmedOutputs = map[string]bool{
+	"GIT_CLONE_COMMIT_MESSAGE_SUBJECT": true,
+	"GIT_CLONE_COMMIT_MESSAGE_BODY":    true,
+	submodulesEnv:                      true,
+}
+
+// EnvmanExporter exports the outputs with envman, the commit message subject and body, and the submodule state
+// are trimmed to the env var size limit of envman
+type EnvmanExporter struct {
+	// Output receives the log messages, they are written to stdout if nil.
+	// NewCloner sets it to the log output of the Cloner.
+	Output io.Writer
+}
+
+// ExportOutput ...
+func (e EnvmanExporter) ExportOutput(key, value string) error {
+	if trimmedOutputs[key] {
+		maxLength, err := getMaxEnvLength()
+		if err != nil {
+			return fmt.Errorf("%w: %v", errMaxEnvLength, err)
+		}
+
+		if len(value) > maxLength {
+			logger{w: e.Output}.Printf("Value %s is bigger than maximum env variable size, trimming", key)
+			value = value[:maxLength-len(trimEnding)] + trimEnding
+		}
+	}
+
+	if err := tools.ExportEnvironmentWithEnvman(key, value); err != nil {
+		return fmt.Errorf("envman export, error: %v", err)
+	}
+	return nil
+}
+
+func getMaxEnvLength() (int, error) {
+	configs, err := envman.GetConfigs()
+	if err != nil {
+		return 0, err
+	}
+
+	return configs.EnvBytesLimitInKB * 1024, nil
+}
+
+const (
+	envmanExporter        = "envman"
+	dotenvExporter        = "dotenv"
+	jsonExporter          = "json"
+	githubActionsExporter = "github_actions"
+)
+
+// newOutputExporter returns the exporter selected by the output_exporter input, envman is the default
+func newOutputExporter(name, outputFile string) (OutputExporter, error) {
+	switch name {
+	case "", envmanExporter:
+		return EnvmanExporter{}, nil
+	case dotenvExporter, jsonExporter:
+		if strings.TrimSpace(outputFile) == "" {
+			return nil, NewParameterValidationError(fmt.Sprintf("%s output exporter can not be used: no output file specified", name))
+		}
+		if name == dotenvExporter {
+			return &DotenvExporter{Path: outputFile}, nil
+		}
+		return &JSONExporter{Path: outputFile}, nil
+	case githubActionsExporter:
+		exporter := GitHubActionsExporter{OutputPath: os.Getenv("GITHUB_OUTPUT"), EnvPath: os.Getenv("GITHUB_ENV")}
+		if exporter.OutputPath == "" && exporter.EnvPath == "" {
+			return nil, NewParameterValidationError("github_actions output exporter can not be used: neither GITHUB_OUTPUT nor GITHUB_ENV is set")
+		}
+		return exporter, nil
+	default:
+		return nil, NewParameterValidationError(fmt.Sprintf("unknown output exporter: %s", name))
+	}
+}
+
+// DotenvExporter writes the outputs to a .env file, the file is rewritten on every export
+type DotenvExporter struct {
+	Path    string
+	outputs []output
+}
+
+// ExportOutput ...
+func (e *DotenvExporter) ExportOutput(key, value string) error {
+	e.outputs = append(e.outputs, output{key, value})
+
+	var content strings.Builder
+	for _, o := range e.outputs {
+		content.WriteString(fmt.Sprintf("%s=%s\n", o.key, dotenvQuote(o.value)))
+	}
+	return ioutil.WriteFile(e.Path, []byte(content.String()), 0600)
+}
+
+// dotenvQuote double quotes the value, escaping backslashes, double quotes, dollar signs and new lines
+func dotenvQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// JSONExporter writes the outputs to a JSON object, the file is rewritten on every export
+type JSONExporter struct {
+	Path    string
+	outputs map[string]string
+}
+
+// ExportOutput ...
+func (e *JSONExporter) ExportOutput(key, value string) error {
+	if e.outputs == nil {
+		e.outputs = map[string]string{}
+	}
+	e.outputs[key] = value
+
+	content, err := json.MarshalIndent(e.outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(e.Path, content, 0600)
+}
+
+// GitHubActionsExporter appends the outputs to the step output ($GITHUB_OUTPUT) and environment ($GITHUB_ENV) files of GitHub Actions
+type GitHubActionsExporter struct {
+	// OutputPath is the step output file, skipped if empty
+	OutputPath string
+	// EnvPath is the environment file of the following steps, skipped if empty
+	EnvPath string
+}
+
+// ExportOutput ...
+func (e GitHubActionsExporter) ExportOutput(key, value string) error {
+	for _, pth := range []string{e.OutputPath, e.EnvPath} {
+		if pth == "" {
+			continue
+		}
+		if err := appendGitHubActionsValue(pth, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendGitHubActionsValue writes the value in the multiline format: key<<delimiter, the value, then the delimiter
+func appendGitHubActionsValue(pth, key, value string) error {
+	delimiter, err := randomDelimiter()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(pth, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(f, "%s<<%s\n%s\n%s\n", key, delimiter, value, delimiter); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func randomDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
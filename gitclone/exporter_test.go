@@ -0,0 +1,92 @@
+package gitclone
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newOutputExporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		exporter   string
+		outputFile string
+		want       OutputExporter
+		wantErr    bool
+	}{
+		{name: "default", exporter: "", want: EnvmanExporter{}},
+		{name: "envman", exporter: "envman", want: EnvmanExporter{}},
+		{name: "dotenv", exporter: "dotenv", outputFile: "outputs.env", want: &DotenvExporter{Path: "outputs.env"}},
+		{name: "json", exporter: "json", outputFile: "outputs.json", want: &JSONExporter{Path: "outputs.json"}},
+		{name: "dotenv without output file", exporter: "dotenv", wantErr: true},
+		{name: "json without output file", exporter: "json", outputFile: " ", wantErr: true},
+		{name: "unknown", exporter: "gitlab", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newOutputExporter(tt.exporter, tt.outputFile)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_DotenvExporter(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "outputs.env")
+	exporter := DotenvExporter{Path: pth}
+
+	assert.NoError(t, exporter.ExportOutput("GIT_CLONE_COMMIT_HASH", "76a934ae"))
+	assert.NoError(t, exporter.ExportOutput("GIT_CLONE_COMMIT_MESSAGE_BODY", "Line \"1\"\nCost: $5 \\ day"))
+
+	content, err := ioutil.ReadFile(pth)
+	assert.NoError(t, err)
+	assert.Equal(t, `GIT_CLONE_COMMIT_HASH="76a934ae"
+GIT_CLONE_COMMIT_MESSAGE_BODY="Line \"1\"\nCost: \$5 \\ day"
+`, string(content))
+}
+
+func Test_JSONExporter(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "outputs.json")
+	exporter := JSONExporter{Path: pth}
+
+	assert.NoError(t, exporter.ExportOutput("GIT_CLONE_COMMIT_HASH", "76a934ae"))
+	assert.NoError(t, exporter.ExportOutput("GIT_CLONE_COMMIT_COUNT", "1"))
+
+	content, err := ioutil.ReadFile(pth)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"GIT_CLONE_COMMIT_HASH": "76a934ae", "GIT_CLONE_COMMIT_COUNT": "1"}`, string(content))
+}
+
+func Test_GitHubActionsExporter(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output")
+	envPath := filepath.Join(dir, "env")
+	assert.NoError(t, ioutil.WriteFile(outputPath, []byte("previous=value\n"), 0600))
+	exporter := GitHubActionsExporter{OutputPath: outputPath, EnvPath: envPath}
+
+	assert.NoError(t, exporter.ExportOutput("GIT_CLONE_COMMIT_MESSAGE_BODY", "Line 1\nLine 2"))
+
+	want := regexp.MustCompile(`^GIT_CLONE_COMMIT_MESSAGE_BODY<<(ghadelimiter_[0-9a-f]{32})\nLine 1\nLine 2\n(ghadelimiter_[0-9a-f]{32})\n$`)
+	for _, pth := range []string{outputPath, envPath} {
+		content, err := ioutil.ReadFile(pth)
+		assert.NoError(t, err)
+
+		value := string(content)
+		if pth == outputPath {
+			assert.Regexp(t, `^previous=value\n`, value, "existing content should be kept")
+			value = value[len("previous=value\n"):]
+		}
+		match := want.FindStringSubmatch(value)
+		if assert.NotNil(t, match, value) {
+			assert.Equal(t, match[1], match[2])
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/command/git"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/sliceutil"
@@ -17,9 +18,26 @@ const (
 	jobsFlag          = "--jobs=10"
 )
 
-var runner CommandRunner = DefaultRunner{}
+// gitRunner creates the git commands of the repository (by git.Git), and runs them with the runner of the clone process.
+// The log messages of the clone process are printed by its logger.
+type gitRunner struct {
+	git.Git
+	runner CommandRunner
+	log    logger
+}
+
+// gitCommand creates a git command not provided by git.Git,
+// it runs in the same directory and with the same environment as the git.Git commands.
+func gitCommand(gitCmd gitRunner, args ...string) *command.Model {
+	base := gitCmd.Status().GetCmd()
+
+	cmd := command.New("git", args...)
+	cmd.SetDir(base.Dir)
+	cmd.SetEnvs(base.Env...)
+	return cmd
+}
 
-func isOriginPresent(gitCmd git.Git, dir, repoURL string) (bool, error) {
+func isOriginPresent(gitCmd gitRunner, dir, repoURL string) (bool, error) {
 	absDir, err := pathutil.AbsPath(dir)
 	if err != nil {
 		return false, err
@@ -29,7 +47,7 @@ func isOriginPresent(gitCmd git.Git, dir, repoURL string) (bool, error) {
 	if exist, err := pathutil.IsDirExists(gitDir); err != nil {
 		return false, err
 	} else if exist {
-		remotes, err := runner.RunForOutput(gitCmd.RemoteList())
+		remotes, err := gitCmd.runner.RunForOutput(gitCmd.RemoteList())
 		if err != nil {
 			return false, err
 		}
@@ -43,17 +61,17 @@ func isOriginPresent(gitCmd git.Git, dir, repoURL string) (bool, error) {
 	return false, nil
 }
 
-func resetRepo(gitCmd git.Git) error {
-	if err := runner.Run(gitCmd.Reset("--hard", "HEAD")); err != nil {
+func resetRepo(gitCmd gitRunner) error {
+	if err := gitCmd.runner.Run(gitCmd.Reset("--hard", "HEAD")); err != nil {
 		return err
 	}
-	if err := runner.Run(gitCmd.Clean("-x", "-d", "-f")); err != nil {
+	if err := gitCmd.runner.Run(gitCmd.Clean("-x", "-d", "-f")); err != nil {
 		return err
 	}
-	if err := runner.Run(gitCmd.SubmoduleForeach(gitCmd.Reset("--hard", "HEAD"))); err != nil {
+	if err := gitCmd.runner.Run(gitCmd.SubmoduleForeach(gitCmd.Reset("--hard", "HEAD"))); err != nil {
 		return err
 	}
-	return runner.Run(gitCmd.SubmoduleForeach(gitCmd.Clean("-x", "-d", "-f")))
+	return gitCmd.runner.Run(gitCmd.SubmoduleForeach(gitCmd.Clean("-x", "-d", "-f")))
 }
 
 func getCheckoutArg(commit, tag, branch string) string {
@@ -69,40 +87,59 @@ func getCheckoutArg(commit, tag, branch string) string {
 	}
 }
 
-func isFork(repoURL, prRepoURL string) bool {
-	return prRepoURL != "" && getRepo(repoURL) != getRepo(prRepoURL)
+func isFork(repoURL, prRepoURL string, log logger) bool {
+	if prRepoURL == "" {
+		return false
+	}
+
+	repo, err := parseRepositoryURL(repoURL)
+	if err != nil {
+		log.Warnf("Failed to parse repository URL: %v", err)
+		return repoURL != prRepoURL
+	}
+	prRepo, err := parseRepositoryURL(prRepoURL)
+	if err != nil {
+		log.Warnf("Failed to parse pull request repository URL: %v", err)
+		return repoURL != prRepoURL
+	}
+
+	return !repo.SameRepository(prRepo)
 }
 
-// formats:
-// https://hostname/owner/repository.git
-// git@hostname:owner/repository.git
-// ssh://git@hostname:port/owner/repository.git
-func getRepo(url string) string {
-	var host, repo string
-	switch {
-	case strings.HasPrefix(url, "https://"):
-		url = strings.TrimPrefix(url, "https://")
-		idx := strings.Index(url, "/")
-		host, repo = url[:idx], url[idx+1:]
-	case strings.HasPrefix(url, "git@"):
-		url = url[strings.Index(url, "@")+1:]
-		idx := strings.Index(url, ":")
-		host, repo = url[:idx], url[idx+1:]
-	case strings.HasPrefix(url, "ssh://"):
-		url = url[strings.Index(url, "@")+1:]
-		if strings.Contains(url, ":") {
-			idxColon, idxSlash := strings.Index(url, ":"), strings.Index(url, "/")
-			host, repo = url[:idxColon], url[idxSlash+1:]
-		} else {
-			idx := strings.Index(url, "/")
-			host, repo = url[:idx], url[idx+1:]
+// addForkRemote adds the fork remote, or updates it if the repository is re-used and the remote exists already
+func addForkRemote(gitCmd gitRunner, forkURL string) error {
+	addErr := gitCmd.runner.Run(gitCmd.RemoteAdd(forkRemoteName, forkURL))
+	if addErr == nil {
+		return nil
+	}
+
+	existingURL, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "remote", "get-url", forkRemoteName))
+	if err != nil {
+		return fmt.Errorf("adding remote fork repository failed (%s): %v", forkURL, addErr)
+	}
+	if existingURL == forkURL {
+		return nil
+	}
+
+	if existing, err := parseRepositoryURL(existingURL); err == nil {
+		if fork, err := parseRepositoryURL(forkURL); err == nil && !existing.SameRepository(fork) {
+			gitCmd.log.Warnf("Remote %s points to a different repository (%s), updating it to %s", forkRemoteName, Redact(existingURL), Redact(forkURL))
 		}
 	}
-	return host + "/" + strings.TrimSuffix(repo, ".git")
+	if err := gitCmd.runner.Run(gitCommand(gitCmd, "remote", "set-url", forkRemoteName, forkURL)); err != nil {
+		return fmt.Errorf("updating remote fork repository failed (%s): %v", forkURL, err)
+	}
+
+	return nil
 }
 
 func isPrivate(repoURL string) bool {
-	return strings.HasPrefix(repoURL, "git")
+	repo, err := parseRepositoryURL(repoURL)
+	if err != nil {
+		return false
+	}
+
+	return repo.RequiresAuthentication()
 }
 
 // If incoming branch matches to pull/x/merge pattern fetchArg
@@ -121,12 +158,12 @@ func mergeArg(mergeBranch string) string {
 
 type getAvailableBranches func() (map[string][]string, error)
 
-func listBranches(gitCmd git.Git) getAvailableBranches {
+func listBranches(gitCmd gitRunner) getAvailableBranches {
 	return func() (map[string][]string, error) {
-		if err := runner.Run(gitCmd.Fetch(jobsFlag)); err != nil {
+		if err := gitCmd.runner.Run(gitCmd.Fetch(jobsFlag)); err != nil {
 			return nil, err
 		}
-		out, err := runner.RunForOutput(gitCmd.Branch("-r"))
+		out, err := gitCmd.runner.RunForOutput(gitCmd.Branch("-r"))
 		if err != nil {
 			return nil, err
 		}
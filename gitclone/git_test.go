@@ -26,42 +26,6 @@ func TestFetchArg(t *testing.T) {
 	}
 }
 
-func Test_getRepo(t *testing.T) {
-	tests := []struct {
-		name string
-		url  string
-		want string
-	}{
-		{
-			name: "HTTPS URL",
-			url:  "https://github.com/bitrise-samples/git-clone-test.git",
-			want: "github.com/bitrise-samples/git-clone-test",
-		},
-		{
-			name: "Long SSH URL",
-			url:  "ssh://git@github.com/bitrise-samples/git-clone-test.git",
-			want: "github.com/bitrise-samples/git-clone-test",
-		},
-		{
-			name: "Long SSH URL with a specific port",
-			url:  "ssh://git@github.com:22/bitrise-samples/git-clone-test.git",
-			want: "github.com/bitrise-samples/git-clone-test",
-		},
-		{
-			name: "Short SSH URL",
-			url:  "git@github.com:bitrise-samples/git-clone-test.git",
-			want: "github.com/bitrise-samples/git-clone-test",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := getRepo(tt.url); got != tt.want {
-				t.Errorf("getRepo() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_parseListBranchesOutput(t *testing.T) {
 	tests := []struct {
 		name string
@@ -2,11 +2,11 @@ package gitclone
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/bitrise-io/envman/envman"
-	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-steputils/stepconf"
+	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 )
 
 // Config is the git clone step configuration
@@ -22,6 +22,8 @@ type Config struct {
 	PRSourceRepositoryURL string `env:"pull_request_repository_url"`
 	PRMergeBranch         string `env:"pull_request_merge_branch"`
 	PRHeadBranch          string `env:"pull_request_head_branch"`
+	PRIsFork              string `env:"pull_request_is_fork,opt[auto,yes,no]"`
+	PRSourcePrivate       string `env:"pull_request_source_private,opt[auto,yes,no]"`
 
 	ResetRepository           bool     `env:"reset_repository,opt[Yes,No]"`
 	CloneDepth                int      `env:"clone_depth"`
@@ -29,54 +31,69 @@ type Config struct {
 	LimitSubmoduleUpdateDepth bool     `env:"limit_submodule_update_depth,opt[yes,no]"`
 	ShouldMergePR             bool     `env:"merge_pr,opt[yes,no]"`
 	SparseDirectories         []string `env:"sparse_directories,multiline"`
-
-	BuildURL         string `env:"build_url"`
-	BuildAPIToken    string `env:"build_api_token"`
-	UpdateSubmodules bool   `env:"update_submodules,opt[yes,no]"`
-	ManualMerge      bool   `env:"manual_merge,opt[yes,no]"`
+	SparseCheckoutMode        string   `env:"sparse_checkout_mode,opt[cone,no_cone]"`
+	SparseSpecFile            string   `env:"sparse_spec_file"`
+	SubmodulePaths            []string `env:"submodule_paths,multiline"`
+	SubmoduleExclude          []string `env:"submodule_exclude,multiline"`
+	SubmoduleJobs             int      `env:"submodule_jobs"`
+	SubmoduleRecursion        string   `env:"submodule_recursion,opt[recursive,top_level]"`
+	SubmoduleUpdateMode       string   `env:"submodule_update_mode,opt[pinned,remote]"`
+	URLRewriteRules           []string `env:"url_rewrite_rules,multiline"`
+	CloneFilter               string   `env:"clone_filter"`
+	UnshallowStrategy         string   `env:"unshallow_strategy,opt[full,progressive]"`
+	UnshallowMaxDepth         int      `env:"unshallow_max_depth"`
+
+	ReferenceRepository           string `env:"reference_repository"`
+	DissociateReferenceRepository bool   `env:"reference_repository_dissociate,opt[yes,no]"`
+	SeedBundle                    string `env:"seed_bundle"`
+
+	VerifySignature             string `env:"verify_signature,opt[off,warn,require]"`
+	SignatureAllowedSignersFile string `env:"signature_allowed_signers_file"`
+	SignatureKeyringFile        string `env:"signature_keyring_file"`
+
+	CommandTimeout int `env:"command_timeout"`
+	StallTimeout   int `env:"stall_timeout"`
+	// The retry options default to defaultRetryPolicy if not set
+	RetryCount   *int `env:"retry_count"`
+	RetryWait    *int `env:"retry_wait"`
+	RetryMaxWait *int `env:"retry_max_wait"`
+
+	GitHTTPUsername string          `env:"git_http_username"`
+	GitHTTPToken    stepconf.Secret `env:"git_http_token"`
+	HostCredentials stepconf.Secret `env:"host_credentials"`
+
+	BuildURL         string          `env:"build_url"`
+	BuildAPIToken    stepconf.Secret `env:"build_api_token"`
+	UpdateSubmodules bool            `env:"update_submodules,opt[yes,no]"`
+	ManualMerge      bool            `env:"manual_merge,opt[yes,no]"`
+	DryRun           bool            `env:"dry_run,opt[yes,no]"`
+
+	OutputExporter string `env:"output_exporter,opt[envman,dotenv,json,github_actions]"`
+	OutputFile     string `env:"output_file"`
 }
 
 const (
-	trimEnding              = "..."
-	originRemoteName        = "origin"
-	forkRemoteName          = "fork"
-	updateSubmodelFailedTag = "update_submodule_failed"
-	sparseCheckoutFailedTag = "sparse_checkout_failed"
+	originRemoteName         = "origin"
+	forkRemoteName           = "fork"
+	updateSubmodelFailedTag  = "update_submodule_failed"
+	sparseCheckoutFailedTag  = "sparse_checkout_failed"
+	unsupportedGitVersionTag = "unsupported_git_version"
 )
 
-func printLogAndExportEnv(gitCmd git.Git, format, env string, maxEnvLength int) error {
-	l, err := runner.RunForOutput(gitCmd.Log(format))
+func checkoutState(gitCmd gitRunner, cfg Config, patch PatchSource, report *cloneReport) error {
+	filter, err := parseCloneFilter(cfg.CloneFilter)
 	if err != nil {
 		return err
 	}
 
-	if (env == "GIT_CLONE_COMMIT_MESSAGE_SUBJECT" || env == "GIT_CLONE_COMMIT_MESSAGE_BODY") && len(l) > maxEnvLength {
-		tv := l[:maxEnvLength-len(trimEnding)] + trimEnding
-		log.Printf("Value %s  is bigger than maximum env variable size, trimming", env)
-		l = tv
-	}
-
-	log.Printf("=> %s\n   value: %s\n", env, l)
-	if err := tools.ExportEnvironmentWithEnvman(env, l); err != nil {
-		return fmt.Errorf("envman export, error: %v", err)
-	}
-	return nil
-}
-
-func getMaxEnvLength() (int, error) {
-	configs, err := envman.GetConfigs()
-	if err != nil {
-		return 0, err
-	}
-
-	return configs.EnvBytesLimitInKB * 1024, nil
-}
-
-func checkoutState(gitCmd git.Git, cfg Config, patch patchSource) error {
-	checkoutMethod, diffFile := selectCheckoutMethod(cfg, patch)
-	fetchOpts := selectFetchOptions(checkoutMethod, cfg.CloneDepth, cfg.FetchTags, cfg.UpdateSubmodules, len(cfg.SparseDirectories) != 0)
+	var decisions decisionLog
+	checkoutMethod, diffFile := selectCheckoutMethod(cfg, patch, &decisions, gitCmd.log)
+	decisions.print(gitCmd.log)
+	report.CheckoutDecisions = decisions
+	fetchOpts := selectFetchOptions(checkoutMethod, cfg.CloneDepth, cfg.FetchTags, cfg.UpdateSubmodules, filter, isSparseCheckout(cfg), gitCmd.log)
+	fetchOpts.progress = true
 
-	checkoutStrategy, err := createCheckoutStrategy(checkoutMethod, cfg, diffFile)
+	checkoutStrategy, err := createCheckoutStrategy(checkoutMethod, cfg, diffFile, gitCmd.log)
 	if err != nil {
 		return err
 	}
@@ -84,64 +101,153 @@ func checkoutState(gitCmd git.Git, cfg Config, patch patchSource) error {
 		return fmt.Errorf("failed to select a checkout stategy")
 	}
 
-	if err := checkoutStrategy.do(gitCmd, fetchOpts, selectFallbacks(checkoutMethod, fetchOpts)); err != nil {
-		log.Infof("Checkout strategy used: %T", checkoutStrategy)
+	report.CheckoutMethod = checkoutMethod.String()
+	report.CheckoutStrategy = fmt.Sprintf("%T", checkoutStrategy)
+	report.Depth = fetchOpts.depth
+	report.Filter = fetchOpts.filter
+	report.SparseDirectories = cfg.SparseDirectories
+
+	fallback := selectFallbacks(checkoutMethod, fetchOpts, cfg.UnshallowStrategy, cfg.UnshallowMaxDepth)
+	if fallback != nil {
+		report.Fallback = fallbackName(fallback)
+		fallback = reportedFallback{fallback: fallback, report: report}
+	}
+
+	if err := checkoutStrategy.do(gitCmd, fetchOpts, fallback); err != nil {
+		gitCmd.log.Infof("Checkout strategy used: %T", checkoutStrategy)
 		return err
 	}
 
 	return nil
 }
 
-func updateSubmodules(gitCmd git.Git, cfg Config) error {
-	if err := runner.Run(gitCmd.SubmoduleUpdate(cfg.LimitSubmoduleUpdateDepth, jobsFlag)); err != nil {
+// Execute is the entry point of the git clone process, the outputs are exported by the configured exporter
+func Execute(cfg Config) error {
+	exporter, err := newOutputExporter(cfg.OutputExporter, cfg.OutputFile)
+	if err != nil {
 		return newStepError(
-			updateSubmodelFailedTag,
-			fmt.Errorf("submodule update: %v", err),
-			"Updating submodules has failed",
+			"invalid_output_exporter",
+			err,
+			"Invalid output exporter configuration",
 		)
 	}
 
-	return nil
+	_, err = NewCloner(WithExporter(exporter)).Clone(cfg)
+	return err
 }
 
-func setupSparseCheckout(gitCmd git.Git, sparseDirectories []string) error {
-	if len(sparseDirectories) == 0 {
-		return nil
+// checkout runs the git clone process, and fills in the result as it progresses
+func (c *Cloner) checkout(cfg Config, result *Result) (err error) {
+	retryPolicy, err := configRetryPolicy(cfg)
+	if err != nil {
+		return newStepError(
+			"invalid_retry_policy",
+			err,
+			"Invalid retry configuration",
+		)
 	}
 
-	initCommand := gitCmd.SparseCheckoutInit(true)
-	if err := runner.Run(initCommand); err != nil {
+	if err := validateSignatureVerification(cfg.VerifySignature, cfg.SignatureAllowedSignersFile, cfg.SignatureKeyringFile); err != nil {
 		return newStepError(
-			sparseCheckoutFailedTag,
-			fmt.Errorf("initializing sparse-checkout config failed: %v", err),
-			"Initializing sparse-checkout config has failed",
+			"invalid_signature_verification",
+			err,
+			"Invalid signature verification configuration",
 		)
 	}
 
-	sparseSetCommand := gitCmd.SparseCheckoutSet(sparseDirectories...)
-	if err := runner.Run(sparseSetCommand); err != nil {
+	if err := validateSubmoduleUpdate(cfg.SubmoduleRecursion, cfg.SubmoduleUpdateMode); err != nil {
 		return newStepError(
-			sparseCheckoutFailedTag,
-			fmt.Errorf("updating sparse-checkout config failed: %v", err),
-			"Updating sparse-checkout config has failed",
+			"invalid_submodule_update",
+			err,
+			"Invalid submodule update configuration",
 		)
 	}
 
-	return nil
-}
+	if err := validateSparseCheckoutMode(cfg.SparseCheckoutMode); err != nil {
+		return newStepError(
+			"invalid_sparse_checkout",
+			err,
+			"Invalid sparse-checkout configuration",
+		)
+	}
 
-// Execute is the entry point of the git clone process
-func Execute(cfg Config) error {
-	maxEnvLength, err := getMaxEnvLength()
+	rewriteRules, err := parseURLRewriteRules(cfg.URLRewriteRules)
+	if err != nil {
+		return newStepError(urlRewriteFailedTag, err, "Invalid URL rewrite rules")
+	}
+
+	c.secrets = c.secrets.with(string(cfg.BuildAPIToken), string(cfg.GitHTTPToken))
+
+	credentials, err := newGitCredentials(cfg.GitHTTPUsername, string(cfg.GitHTTPToken), cfg.RepositoryURL, string(cfg.HostCredentials))
 	if err != nil {
 		return newStepError(
-			"get_max_commit_msg_length_failed",
-			fmt.Errorf("failed to set commit message length: %s", err),
-			"Getting allowed commit message length failed",
+			"invalid_credentials",
+			err,
+			"Invalid credentials configuration",
 		)
 	}
+	for _, httpCredentials := range credentials.http {
+		c.secrets = c.secrets.with(httpCredentials.token)
+	}
+	defer func() {
+		if cErr := credentials.cleanup(); cErr != nil {
+			c.log().Warnf("Failed to remove the generated ssh config: %v", cErr)
+		}
+	}()
+
+	if cfg.DryRun {
+		return dryRun(cfg, result, c.log())
+	}
 
-	gitCmd, err := git.New(cfg.CloneIntoDir)
+	report := newCloneReport()
+	metrics := newCloneMetrics()
+	baseRunner := c.runner
+	if baseRunner == nil {
+		baseRunner = DefaultRunner{
+			Timeout:      time.Duration(cfg.CommandTimeout) * time.Second,
+			StallTimeout: time.Duration(cfg.StallTimeout) * time.Second,
+			Retry:        retryPolicy,
+			Output:       c.output,
+			Secrets:      c.secrets,
+		}
+	}
+	var envs []commandEnv
+	if len(rewriteRules) != 0 {
+		envs = append(envs, rewriteRules)
+	}
+	if !credentials.isEmpty() {
+		envs = append(envs, credentials)
+	}
+	if len(envs) != 0 {
+		// The credentials and the URL rewrite rules are silently ignored by the git versions not supporting them
+		if version, vErr := baseRunner.RunForOutput(command.New("git", "--version")); vErr != nil {
+			c.log().Warnf("Failed to check the git version: %v", vErr)
+		} else if vErr := checkGitConfigEnvSupport(version, c.log()); vErr != nil {
+			return newStepError(unsupportedGitVersionTag, vErr, "Unsupported git version")
+		}
+		baseRunner = envRunner{runner: baseRunner, envs: envs}
+	}
+	runner := reportingRunner{
+		runner: metricsRunner{runner: baseRunner, metrics: metrics},
+		report: report,
+	}
+	defer func() {
+		c.log().Infof("\nClone metrics\n")
+		metrics.print(c.log().stdout())
+		result.Phases = metrics.summary()
+
+		if err != nil {
+			report.Error = c.secrets.redact(err.Error())
+		}
+		report.Phases = result.Phases
+		reportPath, rErr := writeReport(report)
+		if rErr != nil {
+			c.log().Warnf("Failed to write clone report: %v", rErr)
+		}
+		result.ReportPath = reportPath
+	}()
+
+	repoGit, err := git.New(cfg.CloneIntoDir)
 	if err != nil {
 		return newStepError(
 			"git_new",
@@ -149,6 +255,7 @@ func Execute(cfg Config) error {
 			"Creating new git project directory failed",
 		)
 	}
+	gitCmd := gitRunner{Git: repoGit, runner: runner, log: c.log()}
 
 	originPresent, err := isOriginPresent(gitCmd, cfg.CloneIntoDir, cfg.RepositoryURL)
 	if err != nil {
@@ -168,7 +275,7 @@ func Execute(cfg Config) error {
 			)
 		}
 	}
-	if err := runner.Run(gitCmd.Init()); err != nil {
+	if err := gitCmd.runner.Run(gitCmd.Init()); err != nil {
 		return newStepError(
 			"init_git_failed",
 			fmt.Errorf("initializing repository failed: %v", err),
@@ -176,7 +283,7 @@ func Execute(cfg Config) error {
 		)
 	}
 	if !originPresent {
-		if err := runner.Run(gitCmd.RemoteAdd(originRemoteName, cfg.RepositoryURL)); err != nil {
+		if err := gitCmd.runner.Run(gitCmd.RemoteAdd(originRemoteName, cfg.RepositoryURL)); err != nil {
 			return newStepError(
 				"add_remote_failed",
 				fmt.Errorf("adding remote repository failed (%s): %v", cfg.RepositoryURL, err),
@@ -185,58 +292,109 @@ func Execute(cfg Config) error {
 		}
 	}
 
-	if err := setupSparseCheckout(gitCmd, cfg.SparseDirectories); err != nil {
-		return err
+	var rewrites urlRewrites
+	if len(rewriteRules) != 0 {
+		gitCmd.log.Infof("Effective rewritten URLs:")
+		rewrites.add(rewriteRules, "repository", cfg.RepositoryURL, gitCmd.log)
+		rewrites.add(rewriteRules, "pull request repository", cfg.PRSourceRepositoryURL, gitCmd.log)
+	}
+
+	usingReference := false
+	if cfg.ReferenceRepository != "" {
+		if usingReference, err = setupReferenceRepository(cfg.CloneIntoDir, cfg.ReferenceRepository, gitCmd.log); err != nil {
+			return newStepError(
+				referenceRepositoryFailedTag,
+				fmt.Errorf("setting up reference repository failed (%s): %v", cfg.ReferenceRepository, err),
+				"Setting up reference repository failed",
+			)
+		}
+	}
+
+	if cfg.SeedBundle != "" {
+		if err := seedFromBundle(gitCmd, cfg.SeedBundle); err != nil {
+			return newStepError(
+				seedBundleFailedTag,
+				fmt.Errorf("seeding repository from bundle failed (%s): %v", cfg.SeedBundle, err),
+				"Seeding repository from bundle failed",
+			)
+		}
 	}
 
-	if err := checkoutState(gitCmd, cfg, defaultPatchSource{}); err != nil {
+	if err := setupSparseCheckout(gitCmd, cfg); err != nil {
 		return err
 	}
 
+	err = checkoutState(gitCmd, cfg, c.patch, report)
+	result.CheckoutMethod = report.CheckoutMethod
+	if cfg.SeedBundle != "" {
+		if rErr := removeBundleRefs(gitCmd); rErr != nil {
+			gitCmd.log.Warnf("Failed to remove the seed bundle refs: %v", rErr)
+		}
+	}
+	if err != nil {
+		return withURLRewriteRecommendations(err, rewrites)
+	}
+
+	if cfg.SparseSpecFile != "" {
+		if cfg.SparseDirectories, err = applySparseSpecFile(gitCmd, cfg); err != nil {
+			return err
+		}
+		report.SparseDirectories = cfg.SparseDirectories
+	}
+
 	if cfg.UpdateSubmodules {
+		if len(rewriteRules) != 0 {
+			gitCmd.log.Infof("Effective rewritten submodule URLs:")
+			rewrites.addSubmodules(rewriteRules, submoduleURLs(gitCmd), gitCmd.log)
+		}
+
 		if err := updateSubmodules(gitCmd, cfg); err != nil {
-			return err
+			return withURLRewriteRecommendations(err, rewrites)
 		}
 	}
 
-	checkoutArg := getCheckoutArg(cfg.Commit, cfg.Tag, cfg.Branch)
-	if checkoutArg != "" {
-		log.Infof("\nExporting git logs\n")
+	if err := collectCheckedOutState(gitCmd, report, cfg.UpdateSubmodules); err != nil {
+		gitCmd.log.Warnf("Failed to collect checked out state for the clone report: %v", err)
+	}
 
-		for format, env := range map[string]string{
-			`%H`:  "GIT_CLONE_COMMIT_HASH",
-			`%s`:  "GIT_CLONE_COMMIT_MESSAGE_SUBJECT",
-			`%b`:  "GIT_CLONE_COMMIT_MESSAGE_BODY",
-			`%an`: "GIT_CLONE_COMMIT_AUTHOR_NAME",
-			`%ae`: "GIT_CLONE_COMMIT_AUTHOR_EMAIL",
-			`%cn`: "GIT_CLONE_COMMIT_COMMITER_NAME",
-			`%ce`: "GIT_CLONE_COMMIT_COMMITER_EMAIL",
-		} {
-			if err := printLogAndExportEnv(gitCmd, format, env, maxEnvLength); err != nil {
-				return newStepError(
-					"export_envs_failed",
-					fmt.Errorf("gitCmd log failed: %v", err),
-					"Exporting envs failed",
-				)
-			}
+	if report.Submodules != nil {
+		result.Submodules = report.Submodules
+		if result.SubmodulesPath, err = writeSubmoduleState(result.Submodules); err != nil {
+			gitCmd.log.Warnf("Failed to write submodule state: %v", err)
 		}
+	}
 
-		count, err := runner.RunForOutput(gitCmd.RevList("HEAD", "--count"))
-		if err != nil {
+	if usingReference && cfg.DissociateReferenceRepository {
+		if err := dissociateReferenceRepository(gitCmd, cfg.CloneIntoDir); err != nil {
 			return newStepError(
-				"count_commits_failed",
-				fmt.Errorf("get rev-list failed: %v", err),
-				"Counting commits failed",
+				referenceRepositoryFailedTag,
+				fmt.Errorf("dissociating from reference repository failed (%s): %v", cfg.ReferenceRepository, err),
+				"Dissociating from reference repository failed",
 			)
 		}
+	}
 
-		log.Printf("=> %s\n   value: %s\n", "GIT_CLONE_COMMIT_COUNT", count)
-		if err := tools.ExportEnvironmentWithEnvman("GIT_CLONE_COMMIT_COUNT", count); err != nil {
-			return newStepError(
-				"export_envs_commit_count_failed",
-				fmt.Errorf("envman export failed: %v", err),
-				"Exporting commit count env failed",
-			)
+	if cfg.VerifySignature == signatureWarn || cfg.VerifySignature == signatureRequire {
+		gitCmd.log.Infof("\nVerifying signature\n")
+		signature, err := verifySignature(gitCmd, cfg, report.CheckoutMethod)
+		result.Signature = signature
+		if err != nil {
+			if cfg.VerifySignature == signatureRequire {
+				return newStepError(
+					signatureVerificationFailedTag,
+					err,
+					"Signature verification failed",
+				)
+			}
+			gitCmd.log.Warnf("Signature verification failed: %v", err)
+		} else {
+			gitCmd.log.Donef("Signature of %s is verified, signed by %s (%s)", signature.Object, signature.Signer, signature.Key)
+		}
+	}
+
+	if getCheckoutArg(cfg.Commit, cfg.Tag, cfg.Branch) != "" {
+		if result.Commit, err = readCommitInfo(gitCmd); err != nil {
+			return err
 		}
 	}
 
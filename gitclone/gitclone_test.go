@@ -6,7 +6,6 @@ import (
 	"testing"
 
 	"github.com/bitrise-io/bitrise-init/step"
-	"github.com/bitrise-io/go-utils/command/git"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +14,7 @@ const rawCmdError = "dummy_cmd_error"
 var testCases = [...]struct {
 	name        string
 	cfg         Config
-	patchSource patchSource
+	patchSource PatchSource
 	mockRunner  *MockRunner
 	wantErr     error
 	wantErrType error
@@ -34,7 +33,7 @@ var testCases = [...]struct {
 			CloneDepth: 1,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress"`,
 			`git "checkout" "76a934a"`,
 		},
 	},
@@ -46,7 +45,7 @@ var testCases = [...]struct {
 			FetchTags: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--tags" "--no-recurse-submodules" "origin" "refs/heads/hcnarb"`,
+			`git "fetch" "--jobs=10" "--tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -57,11 +56,23 @@ var testCases = [...]struct {
 		},
 		mockRunner: givenMockRunnerSucceedsAfter(1),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
+	{
+		name: "Checkout commit with stall detection",
+		cfg: Config{
+			Commit:       "76a934a",
+			CloneDepth:   1,
+			StallTimeout: 60,
+		},
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "76a934a"`,
+		},
+	},
 	{
 		name: "Checkout branch",
 		cfg: Config{
@@ -69,7 +80,7 @@ var testCases = [...]struct {
 			CloneDepth: 1,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/hcnarb"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
 			`git "checkout" "hcnarb"`,
 			`git "merge" "origin/hcnarb"`,
 		},
@@ -81,7 +92,7 @@ var testCases = [...]struct {
 			CloneDepth: 1,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/tags/gat:refs/tags/gat"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/tags/gat:refs/tags/gat"`,
 			`git "checkout" "gat"`,
 		},
 	},
@@ -91,7 +102,7 @@ var testCases = [...]struct {
 			Tag: "gat",
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/tags/gat:refs/tags/gat"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/tags/gat:refs/tags/gat"`,
 			`git "checkout" "gat"`,
 		},
 	},
@@ -101,7 +112,7 @@ var testCases = [...]struct {
 			Tag: "gat",
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/tags/gat:refs/tags/gat"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/tags/gat:refs/tags/gat"`,
 			`git "checkout" "gat"`,
 		},
 	},
@@ -113,7 +124,7 @@ var testCases = [...]struct {
 			Branch: "hcnarb",
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/hcnarb"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -124,7 +135,7 @@ var testCases = [...]struct {
 			Tag:    "gat",
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -142,11 +153,12 @@ var testCases = [...]struct {
 			ShouldMergePR: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,     // Already on 'master'
 			`git "merge" "origin/master"`, // Already up to date.
 			`git "log" "-1" "--format=%H"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/test/commit-messages"`,
+			`git "merge-base" "origin/master" "76a934ae"`,
 			`git "merge" "76a934ae"`,
 			`git "checkout" "--detach"`,
 		},
@@ -161,11 +173,11 @@ var testCases = [...]struct {
 			ShouldMergePR: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "log" "-1" "--format=%H"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/test/commit-messages"`,
 			`git "merge" "76a934ae"`,
 			`git "checkout" "--detach"`,
 		},
@@ -183,12 +195,13 @@ var testCases = [...]struct {
 			ShouldMergePR:         true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "log" "-1" "--format=%H"`,
 			`git "remote" "add" "fork" "https://github.com/bitrise-io/other-repo.git"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "fork" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "fork" "refs/heads/test/commit-messages"`,
+			`git "merge-base" "origin/master" "fork/test/commit-messages"`,
 			`git "merge" "fork/test/commit-messages"`,
 			`git "checkout" "--detach"`,
 		},
@@ -206,11 +219,11 @@ var testCases = [...]struct {
 			ShouldMergePR:         true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "log" "-1" "--format=%H"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/test/commit-messages"`,
 			`git "merge" "76a934ae"`,
 			`git "checkout" "--detach"`,
 		},
@@ -227,8 +240,9 @@ var testCases = [...]struct {
 			ShouldMergePR: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/pull/5/head:pull/5"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "merge" "pull/5"`,
@@ -243,8 +257,8 @@ var testCases = [...]struct {
 			ShouldMergePR: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/pr_test:pr_test"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/pr_test:pr_test"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "merge" "pr_test"`, // warning: refname 'pr_test' is ambiguous.
@@ -264,8 +278,8 @@ var testCases = [...]struct {
 			ShouldMergePR:         true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/pull/7/head:pull/7"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/7/head:pull/7"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "merge" "pull/7"`,
@@ -290,9 +304,9 @@ var testCases = [...]struct {
 			GivenRunWithRetryFailsAfter(2).
 			GivenRunSucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--no-tags" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--no-tags" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--progress" "origin" "refs/heads/master"`,
 			`git "fetch" "--jobs=10"`,
 			`git "branch" "-r"`,
 		},
@@ -313,7 +327,7 @@ var testCases = [...]struct {
 		patchSource: MockPatchSource{"diff_path", nil},
 		wantErr:     nil,
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "apply" "--index" "diff_path"`,
 			`git "checkout" "--detach"`,
@@ -337,14 +351,15 @@ var testCases = [...]struct {
 			GivenRunWithRetrySucceeds().
 			GivenRunSucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "apply" "--index" "diff_path"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "log" "-1" "--format=%H"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/test/commit-messages"`,
+			`git "merge-base" "origin/master" "76a934ae"`,
 			`git "merge" "76a934ae"`,
 			`git "checkout" "--detach"`,
 		},
@@ -367,15 +382,15 @@ var testCases = [...]struct {
 			GivenRunWithRetrySucceeds().
 			GivenRunSucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "apply" "--index" "diff_path"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "log" "-1" "--format=%H"`,
 			`git "remote" "add" "fork" "git@github.com:bitrise-io/other-repo.git"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "fork" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "fork" "refs/heads/test/commit-messages"`,
 			`git "merge" "fork/test/commit-messages"`,
 			`git "checkout" "--detach"`,
 		},
@@ -394,7 +409,7 @@ var testCases = [...]struct {
 			UpdateSubmodules: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "origin" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress" "origin" "refs/heads/test/commit-messages"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -410,7 +425,7 @@ var testCases = [...]struct {
 			UpdateSubmodules: true,
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "origin" "refs/pull/5/head"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress" "origin" "refs/pull/5/head"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -431,7 +446,7 @@ var testCases = [...]struct {
 		wantErr:     nil,
 		wantCmds: []string{
 			`git "remote" "add" "fork" "https://github.com/bitrise-io/git-clone-test2.git"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "fork" "refs/heads/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress" "fork" "refs/heads/test/commit-messages"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -452,7 +467,7 @@ var testCases = [...]struct {
 		patchSource: MockPatchSource{"diff_path", nil},
 		wantErr:     nil,
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress" "origin" "refs/heads/master"`,
 			`git "checkout" "master"`,
 			`git "apply" "--index" "diff_path"`,
 			`git "checkout" "--detach"`,
@@ -469,9 +484,9 @@ var testCases = [...]struct {
 			GivenRunWithRetryFailsAfter(2).
 			GivenRunSucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/fake"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/fake"`,
-			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/fake"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/fake"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/fake"`,
+			`git "fetch" "--jobs=10" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/fake"`,
 			`git "fetch" "--jobs=10"`,
 			`git "branch" "-r"`,
 		},
@@ -509,11 +524,11 @@ var testCases = [...]struct {
 			GivenRunWithRetrySucceeds().
 			GivenRunSucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress"`,
 			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
 			// fatal: reference is not a tree: cfba2b01332e31cb1568dbf3f22edce063118bae
 			// Checkout failed, error: fatal: reference is not a tree: cfba2b01332e31cb1568dbf3f22edce063118bae
-			`git "fetch" "--jobs=10" "--unshallow" "--no-tags"`,
+			`git "fetch" "--jobs=10" "--unshallow" "--no-tags" "--progress"`,
 			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
 		},
 	},
@@ -543,8 +558,9 @@ var testCases = [...]struct {
 			GivenRunSucceeds().
 			GivenRunWithRetrySucceeds(),
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/master"`,
-			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "origin" "refs/pull/5/head:pull/5"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
 			`git "checkout" "master"`,
 			`git "merge" "origin/master"`,
 			`git "merge" "pull/5"`,
@@ -554,11 +570,144 @@ var testCases = [...]struct {
 			`git "clean" "-x" "-d" "-f"`,
 			`git "submodule" "foreach" "git" "reset" "--hard" "HEAD"`,
 			`git "submodule" "foreach" "git" "clean" "-x" "-d" "-f"`,
-			`git "fetch" "--jobs=10" "--unshallow" "--no-tags" "--no-recurse-submodules"`,
+			`git "fetch" "--jobs=10" "--unshallow" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "merge" "pull/5"`,
+			`git "checkout" "--detach"`,
+		},
+	},
+	{
+		name: "Checkout commit, progressive unshallow succeeds after deepening",
+		cfg: Config{
+			Commit:            "cfba2b01332e31cb1568dbf3f22edce063118bae",
+			CloneDepth:        1,
+			UpdateSubmodules:  true,
+			UnshallowStrategy: "progressive",
+		},
+		mockRunner: givenMockRunner().
+			GivenRunFailsForCommand(`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`, 1).
+			GivenRunWithRetrySucceeds().
+			GivenRunSucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+		},
+	},
+	{
+		name: "Checkout commit, progressive unshallow reaches maximum depth",
+		cfg: Config{
+			Commit:            "cfba2b01332e31cb1568dbf3f22edce063118bae",
+			CloneDepth:        2,
+			UnshallowStrategy: "progressive",
+			UnshallowMaxDepth: 6,
+		},
+		mockRunner: givenMockRunner().
+			GivenRunFailsForCommand(`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`, 3).
+			GivenRunWithRetrySucceeds().
+			GivenRunSucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=2" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+			`git "fetch" "--jobs=10" "--deepen=2" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+			`git "fetch" "--jobs=10" "--deepen=2" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+			`git "fetch" "--jobs=10" "--unshallow" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+		},
+	},
+	{
+		name: "Checkout PR - auto merge - merge branch, progressive unshallow",
+		cfg: Config{
+			PRDestBranch:      "master",
+			PRMergeBranch:     "pull/5/merge",
+			CloneDepth:        1,
+			ShouldMergePR:     true,
+			UnshallowStrategy: "progressive",
+		},
+		mockRunner: givenMockRunner().
+			GivenRunFailsForCommand(`git "merge" "pull/5"`, 1).
+			GivenRunSucceeds().
+			GivenRunWithRetrySucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "checkout" "master"`,
+			`git "merge" "origin/master"`,
+			`git "merge" "pull/5"`,
+			`git "reset" "--hard" "HEAD"`,
+			`git "clean" "-x" "-d" "-f"`,
+			`git "submodule" "foreach" "git" "reset" "--hard" "HEAD"`,
+			`git "submodule" "foreach" "git" "clean" "-x" "-d" "-f"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "merge" "pull/5"`,
+			`git "checkout" "--detach"`,
+		},
+	},
+	{
+		name: "Checkout PR - auto merge - merge branch, deepen until merge base found",
+		cfg: Config{
+			PRDestBranch:  "master",
+			PRMergeBranch: "pull/5/merge",
+			CloneDepth:    1,
+			ShouldMergePR: true,
+		},
+		mockRunner: new(MockRunner).
+			GivenRunForOutputFailsForCommand(`git "merge-base" "origin/master" "pull/5"`, 2).
+			GivenRunForOutputSucceeds().
+			GivenRunWithRetrySucceeds().
+			GivenRunSucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "fetch" "--jobs=10" "--deepen=2" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--deepen=2" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "checkout" "master"`,
+			`git "merge" "origin/master"`,
 			`git "merge" "pull/5"`,
 			`git "checkout" "--detach"`,
 		},
 	},
+	{
+		name: "PR - fork - manual merge: no merge base found within maximum depth",
+		cfg: Config{
+			RepositoryURL:         "https://github.com/bitrise-io/git-clone-test.git",
+			PRSourceRepositoryURL: "https://github.com/bitrise-io/other-repo.git",
+			Branch:                "test/commit-messages",
+			PRDestBranch:          "master",
+			Commit:                "76a934ae",
+			CloneDepth:            1,
+			ManualMerge:           true,
+			ShouldMergePR:         true,
+			UnshallowMaxDepth:     2,
+		},
+		mockRunner: new(MockRunner).
+			GivenRunForOutputFailsForCommand(`git "merge-base" "origin/master" "fork/test/commit-messages"`, 2).
+			GivenRunForOutputSucceeds().
+			GivenRunWithRetrySucceeds().
+			GivenRunSucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "checkout" "master"`,
+			`git "merge" "origin/master"`,
+			`git "log" "-1" "--format=%H"`,
+			`git "remote" "add" "fork" "https://github.com/bitrise-io/other-repo.git"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress" "fork" "refs/heads/test/commit-messages"`,
+			`git "merge-base" "origin/master" "fork/test/commit-messages"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--deepen=1" "--no-tags" "--no-recurse-submodules" "--progress" "fork" "refs/heads/test/commit-messages"`,
+			`git "merge-base" "origin/master" "fork/test/commit-messages"`,
+			`git "merge" "fork/test/commit-messages"`,
+			`git "checkout" "--detach"`,
+		},
+	},
 
 	// ** Sparse-checkout **
 	{
@@ -569,7 +718,7 @@ var testCases = [...]struct {
 			SparseDirectories: []string{"client/android"},
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules"`,
+			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "--progress"`,
 			`git "checkout" "76a934a"`,
 		},
 	},
@@ -581,7 +730,7 @@ var testCases = [...]struct {
 			SparseDirectories: []string{"client/android"},
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/hcnarb"`,
+			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
 			`git "checkout" "76a934ae"`,
 		},
 	},
@@ -593,7 +742,7 @@ var testCases = [...]struct {
 			SparseDirectories: []string{"client/android"},
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "origin" "refs/heads/hcnarb"`,
+			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
 			`git "checkout" "hcnarb"`,
 			`git "merge" "origin/hcnarb"`,
 		},
@@ -606,10 +755,106 @@ var testCases = [...]struct {
 			SparseDirectories: []string{"client/android"},
 		},
 		wantCmds: []string{
-			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "origin" "refs/tags/gat:refs/tags/gat"`,
+			`git "fetch" "--jobs=10" "--filter=tree:0" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/tags/gat:refs/tags/gat"`,
 			`git "checkout" "gat"`,
 		},
 	},
+
+	// ** Partial clone **
+	{
+		name: "Checkout commit - blobless clone",
+		cfg: Config{
+			Commit:      "76a934a",
+			CloneDepth:  1,
+			CloneFilter: "blob:none",
+		},
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "76a934a"`,
+		},
+	},
+	{
+		name: "Checkout branch - blob size limit",
+		cfg: Config{
+			Branch:      "hcnarb",
+			CloneFilter: "blob:limit=1m",
+		},
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--filter=blob:limit=1m" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/hcnarb"`,
+			`git "checkout" "hcnarb"`,
+			`git "merge" "origin/hcnarb"`,
+		},
+	},
+	{
+		name: "Checkout commit - sparse, partial clone disabled",
+		cfg: Config{
+			Commit:            "76a934a",
+			CloneDepth:        1,
+			SparseDirectories: []string{"client/android"},
+			CloneFilter:       "none",
+		},
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "checkout" "76a934a"`,
+		},
+	},
+	{
+		name: "Checkout PR - auto merge - merge branch, sparse",
+		cfg: Config{
+			PRDestBranch:      "master",
+			PRMergeBranch:     "pull/5/merge",
+			CloneDepth:        1,
+			ShouldMergePR:     true,
+			SparseDirectories: []string{"client/android"},
+		},
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "checkout" "master"`,
+			`git "merge" "origin/master"`,
+			`git "merge" "pull/5"`,
+			`git "checkout" "--detach"`,
+		},
+	},
+	{
+		name: "Checkout PR - auto merge - merge branch, treeless clone falls back to blobless, unshallow needed",
+		cfg: Config{
+			PRDestBranch:  "master",
+			PRMergeBranch: "pull/5/merge",
+			CloneDepth:    1,
+			ShouldMergePR: true,
+			CloneFilter:   "tree:0",
+		},
+		mockRunner: givenMockRunner().
+			GivenRunFailsForCommand(`git "merge" "pull/5"`, 1).
+			GivenRunSucceeds().
+			GivenRunWithRetrySucceeds(),
+		wantCmds: []string{
+			`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/heads/master"`,
+			`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress" "origin" "refs/pull/5/head:pull/5"`,
+			`git "merge-base" "origin/master" "pull/5"`,
+			`git "checkout" "master"`,
+			`git "merge" "origin/master"`,
+			`git "merge" "pull/5"`,
+			`git "reset" "--hard" "HEAD"`,
+			`git "clean" "-x" "-d" "-f"`,
+			`git "submodule" "foreach" "git" "reset" "--hard" "HEAD"`,
+			`git "submodule" "foreach" "git" "clean" "-x" "-d" "-f"`,
+			`git "fetch" "--jobs=10" "--unshallow" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress"`,
+			`git "merge" "pull/5"`,
+			`git "checkout" "--detach"`,
+		},
+	},
+	{
+		name: "Checkout commit - invalid clone filter",
+		cfg: Config{
+			Commit:      "76a934a",
+			CloneFilter: "blob:limit=big",
+		},
+		wantErrType: ParameterValidationError{},
+		wantCmds:    nil,
+	},
 }
 
 func Test_checkoutState(t *testing.T) {
@@ -622,10 +867,9 @@ func Test_checkoutState(t *testing.T) {
 			} else {
 				mockRunner = givenMockRunnerSucceeds()
 			}
-			runner = mockRunner
 
 			// When
-			actualErr := checkoutState(git.Git{}, tt.cfg, tt.patchSource)
+			actualErr := checkoutState(gitRunner{runner: mockRunner}, tt.cfg, tt.patchSource, newCloneReport())
 
 			// Then
 			if tt.wantErrType != nil {
@@ -643,9 +887,11 @@ func Test_checkoutState(t *testing.T) {
 
 // SubmoduleUpdate
 var submoduleTestCases = [...]struct {
-	name     string
-	cfg      Config
-	wantCmds []string
+	name string
+	cfg  Config
+	// gitmodules is the output of listing the submodule paths of .gitmodules
+	gitmodules string
+	wantCmds   []string
 }{
 	{
 		name: "Limiting submodule depth",
@@ -653,7 +899,7 @@ var submoduleTestCases = [...]struct {
 			LimitSubmoduleUpdateDepth: true,
 		},
 		wantCmds: []string{
-			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--depth=1"`,
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress" "--depth=1"`,
 		},
 	},
 	{
@@ -662,7 +908,85 @@ var submoduleTestCases = [...]struct {
 			LimitSubmoduleUpdateDepth: false,
 		},
 		wantCmds: []string{
-			`git "submodule" "update" "--init" "--recursive" "--jobs=10"`,
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress"`,
+		},
+	},
+	{
+		name: "Blobless submodule update",
+		cfg: Config{
+			LimitSubmoduleUpdateDepth: true,
+			CloneFilter:               "blob:none",
+		},
+		wantCmds: []string{
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--filter=blob:none" "--progress" "--depth=1"`,
+		},
+	},
+	{
+		name: "Custom submodule job count",
+		cfg: Config{
+			SubmoduleJobs: 4,
+		},
+		wantCmds: []string{
+			`git "submodule" "update" "--init" "--recursive" "--jobs=4" "--progress"`,
+		},
+	},
+	{
+		name: "Top-level submodules only",
+		cfg: Config{
+			SubmoduleRecursion: "top_level",
+		},
+		wantCmds: []string{
+			`git "submodule" "update" "--init" "--jobs=10" "--progress"`,
+		},
+	},
+	{
+		name: "Remote submodule update",
+		cfg: Config{
+			LimitSubmoduleUpdateDepth: true,
+			SubmoduleUpdateMode:       "remote",
+		},
+		wantCmds: []string{
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress" "--remote" "--depth=1"`,
+			`git "submodule" "status" "--recursive"`,
+			`git "submodule" "status" "--cached" "--recursive"`,
+		},
+	},
+	{
+		name: "Selected submodules",
+		cfg: Config{
+			LimitSubmoduleUpdateDepth: true,
+			SubmodulePaths:            []string{"ios/**", "shared"},
+			SubmoduleExclude:          []string{"ios/vendor/analytics"},
+		},
+		gitmodules: `submodule.ios-ui.path ios/ui
+submodule.analytics.path ios/vendor/analytics
+submodule.android-ui.path android/ui
+submodule.shared.path shared`,
+		wantCmds: []string{
+			`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`,
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress" "--depth=1" "--" "ios/ui" "shared"`,
+		},
+	},
+	{
+		name: "Submodules outside of sparse directories",
+		cfg: Config{
+			SparseDirectories: []string{"ios"},
+		},
+		gitmodules: `submodule.ios-ui.path ios/ui
+submodule.android-ui.path android/ui`,
+		wantCmds: []string{
+			`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`,
+			`git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress" "--" "ios/ui"`,
+		},
+	},
+	{
+		name: "No submodule selected",
+		cfg: Config{
+			SubmoduleExclude: []string{"*"},
+		},
+		gitmodules: `submodule.ios-ui.path ios/ui`,
+		wantCmds: []string{
+			`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`,
 		},
 	},
 }
@@ -671,11 +995,16 @@ func Test_SubmoduleUpdate(t *testing.T) {
 	for _, tt := range submoduleTestCases {
 		t.Run(tt.name, func(t *testing.T) {
 			// Given
-			mockRunner := givenMockRunnerSucceeds()
-			runner = mockRunner
+			mockRunner := new(MockRunner)
+			if tt.gitmodules != "" {
+				mockRunner.GivenRunForOutputSucceedsForCommand(`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`, tt.gitmodules)
+			}
+			mockRunner.GivenRunForOutputSucceeds().
+				GivenRunWithRetrySucceeds().
+				GivenRunSucceeds()
 
 			// When
-			actualErr := updateSubmodules(git.Git{}, tt.cfg)
+			actualErr := updateSubmodules(gitRunner{runner: mockRunner}, tt.cfg)
 
 			// Then
 			assert.NoError(t, actualErr)
@@ -686,26 +1015,41 @@ func Test_SubmoduleUpdate(t *testing.T) {
 
 // SetupSparseCechkout
 var sparseCheckoutTestCases = [...]struct {
-	name              string
-	sparseDirectories []string
-	wantCmds          []string
+	name     string
+	cfg      Config
+	wantCmds []string
 }{
 	{
-		name:              "Sparse-checkout single directory",
-		sparseDirectories: []string{"client/android"},
+		name: "Sparse-checkout single directory",
+		cfg:  Config{SparseDirectories: []string{"client/android"}},
 		wantCmds: []string{
 			`git "sparse-checkout" "init" "--cone"`,
 			`git "sparse-checkout" "set" "client/android"`,
 		},
 	},
 	{
-		name:              "Sparse-checkout multiple directory",
-		sparseDirectories: []string{"client/android", "client/ios"},
+		name: "Sparse-checkout multiple directory",
+		cfg:  Config{SparseDirectories: []string{"client/android", "client/ios"}},
 		wantCmds: []string{
 			`git "sparse-checkout" "init" "--cone"`,
 			`git "sparse-checkout" "set" "client/android" "client/ios"`,
 		},
 	},
+	{
+		name: "Sparse-checkout non-cone patterns",
+		cfg:  Config{SparseDirectories: []string{"/*", "!/*/", "**/*.swift"}, SparseCheckoutMode: "no_cone"},
+		wantCmds: []string{
+			`git "sparse-checkout" "init" "--no-cone"`,
+			`git "sparse-checkout" "set" "--no-cone" "/*" "!/*/" "**/*.swift"`,
+		},
+	},
+	{
+		name: "Sparse-checkout specification file only",
+		cfg:  Config{SparseSpecFile: ".bitrise/sparse-ios"},
+		wantCmds: []string{
+			`git "sparse-checkout" "init" "--cone"`,
+		},
+	},
 }
 
 func Test_SetupSparseCheckout(t *testing.T) {
@@ -713,10 +1057,9 @@ func Test_SetupSparseCheckout(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Given
 			mockRunner := givenMockRunnerSucceeds()
-			runner = mockRunner
 
 			// When
-			actualErr := setupSparseCheckout(git.Git{}, tt.sparseDirectories)
+			actualErr := setupSparseCheckout(gitRunner{runner: mockRunner}, tt.cfg)
 
 			// Then
 			assert.NoError(t, actualErr)
@@ -747,6 +1090,6 @@ type MockPatchSource struct {
 	err          error
 }
 
-func (m MockPatchSource) getDiffPath(_, _ string) (string, error) {
+func (m MockPatchSource) DiffPath(_, _ string) (string, error) {
 	return m.diffFilePath, m.err
 }
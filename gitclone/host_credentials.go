@@ -0,0 +1,160 @@
+package gitclone
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	tokenCredentialPrefix  = "token:"
+	sshKeyCredentialPrefix = "ssh_key:"
+	sshConfigFileName      = "ssh_config"
+)
+
+// hostCredential is the credential of a host, either an HTTPS username and token or an SSH key
+type hostCredential struct {
+	host     string
+	username string
+	token    string
+	sshKey   string
+}
+
+// parseHostCredentials parses the host to credential mapping, one host per line, formatted as:
+// <host>=token:<username>:<token> or <host>=ssh_key:<path of the private key>
+// Empty lines and lines starting with # are ignored.
+func parseHostCredentials(spec string) ([]hostCredential, error) {
+	var credentials []hostCredential
+	for i, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		host, credential, found := cutString(line, "=")
+		host, credential = strings.TrimSpace(host), strings.TrimSpace(credential)
+		if !found || host == "" || strings.Contains(host, "/") {
+			return nil, NewParameterValidationError(fmt.Sprintf("invalid host credential (line %d): expected <host>=token:<username>:<token> or <host>=ssh_key:<path>", i+1))
+		}
+
+		c := hostCredential{host: host}
+		switch {
+		case strings.HasPrefix(credential, tokenCredentialPrefix):
+			username, token, found := cutString(strings.TrimPrefix(credential, tokenCredentialPrefix), ":")
+			if !found || username == "" || token == "" {
+				return nil, NewParameterValidationError(fmt.Sprintf("invalid host credential for %s (line %d): expected token:<username>:<token>", host, i+1))
+			}
+			c.username, c.token = username, token
+		case strings.HasPrefix(credential, sshKeyCredentialPrefix):
+			pth, err := pathutil.AbsPath(strings.TrimPrefix(credential, sshKeyCredentialPrefix))
+			if err != nil {
+				return nil, NewParameterValidationError(fmt.Sprintf("invalid SSH key path for %s (line %d): %v", host, i+1, err))
+			}
+			if exist, err := pathutil.IsPathExists(pth); err != nil {
+				return nil, err
+			} else if !exist {
+				return nil, NewParameterValidationError(fmt.Sprintf("SSH key for %s (line %d) does not exist: %s", host, i+1, pth))
+			}
+			c.sshKey = pth
+		default:
+			return nil, NewParameterValidationError(fmt.Sprintf("invalid host credential for %s (line %d): unknown credential type, use token: or ssh_key:", host, i+1))
+		}
+
+		credentials = append(credentials, c)
+	}
+
+	return credentials, nil
+}
+
+func cutString(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// sshHost returns the host name of a host (with an optional port), as matched by the ssh config's Host keyword
+func sshHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// sshConfig selects the SSH key of the hosts, the user's and the system's ssh config is included for the other hosts
+func sshConfig(credentials []hostCredential) string {
+	var b strings.Builder
+	for _, c := range credentials {
+		if c.sshKey == "" {
+			continue
+		}
+
+		fmt.Fprintf(&b, "Host %s\n", sshHost(c.host))
+		fmt.Fprintf(&b, "  IdentityFile \"%s\"\n", c.sshKey)
+		fmt.Fprintf(&b, "  IdentitiesOnly yes\n\n")
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+
+	b.WriteString("Host *\n")
+	b.WriteString("  Include ~/.ssh/config\n")
+	b.WriteString("  Include /etc/ssh/ssh_config\n")
+	return b.String()
+}
+
+// newGitCredentials collects the credentials of the repository's host and the mapped hosts.
+// The repository's own credentials take precedence over a mapping for the same host.
+func newGitCredentials(httpUsername, httpToken, repositoryURL, hostCredentials string) (gitCredentials, error) {
+	mapped, err := parseHostCredentials(hostCredentials)
+	if err != nil {
+		return gitCredentials{}, err
+	}
+
+	var credentials gitCredentials
+	for _, c := range mapped {
+		if c.token != "" {
+			credentials.http = append(credentials.http, httpCredentials{
+				username: c.username,
+				token:    c.token,
+				scope:    "https://" + c.host,
+			})
+		}
+	}
+
+	repoCredentials, err := newHTTPCredentials(httpUsername, httpToken, repositoryURL)
+	if err != nil {
+		return gitCredentials{}, err
+	}
+	if repoCredentials != nil {
+		credentials.http = append(credentials.http, *repoCredentials)
+	}
+
+	if config := sshConfig(mapped); config != "" {
+		tmpDir, err := pathutil.NormalizedOSTempDirPath("git-clone-ssh")
+		if err != nil {
+			return gitCredentials{}, err
+		}
+
+		pth := filepath.Join(tmpDir, sshConfigFileName)
+		if err := fileutil.WriteStringToFile(pth, config); err != nil {
+			return gitCredentials{}, err
+		}
+		credentials.sshConfig = pth
+	}
+
+	return credentials, nil
+}
+
+// cleanup removes the generated ssh config
+func (c gitCredentials) cleanup() error {
+	if c.sshConfig == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Dir(c.sshConfig))
+}
@@ -0,0 +1,106 @@
+package gitclone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseHostCredentials(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "host-credentials")
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, os.RemoveAll(tmpDir))
+	}()
+	keyPath := filepath.Join(tmpDir, "id_rsa")
+	assert.NoError(t, fileutil.WriteStringToFile(keyPath, "key"))
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    []hostCredential
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			spec: "",
+		},
+		{
+			name: "token and SSH key",
+			spec: "# GitLab instance of the submodules\ngitlab.example.com = token:oauth2:glpat-token:with-colon\n\nbitbucket.org=ssh_key:" + keyPath + "\n",
+			want: []hostCredential{
+				{host: "gitlab.example.com", username: "oauth2", token: "glpat-token:with-colon"},
+				{host: "bitbucket.org", sshKey: keyPath},
+			},
+		},
+		{
+			name:    "missing host",
+			spec:    "=token:oauth2:glpat-token",
+			wantErr: true,
+		},
+		{
+			name:    "URL instead of host",
+			spec:    "https://gitlab.example.com=token:oauth2:glpat-token",
+			wantErr: true,
+		},
+		{
+			name:    "missing username",
+			spec:    "gitlab.example.com=token:glpat-token",
+			wantErr: true,
+		},
+		{
+			name:    "unknown credential type",
+			spec:    "gitlab.example.com=password:secret",
+			wantErr: true,
+		},
+		{
+			name:    "missing SSH key",
+			spec:    "bitbucket.org=ssh_key:" + filepath.Join(tmpDir, "missing"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHostCredentials(tt.spec)
+			if tt.wantErr {
+				assert.IsType(t, ParameterValidationError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_sshConfig(t *testing.T) {
+	assert.Equal(t, "", sshConfig([]hostCredential{{host: "gitlab.example.com", username: "oauth2", token: "token"}}))
+
+	want := `Host ssh.example.com
+  IdentityFile "/keys/example"
+  IdentitiesOnly yes
+
+Host *
+  Include ~/.ssh/config
+  Include /etc/ssh/ssh_config
+`
+	assert.Equal(t, want, sshConfig([]hostCredential{{host: "ssh.example.com:2222", sshKey: "/keys/example"}}))
+}
+
+func Test_newGitCredentials(t *testing.T) {
+	credentials, err := newGitCredentials("x-access-token", "ghp_token", "https://github.com/bitrise-io/git-clone.git", "gitlab.example.com=token:oauth2:glpat-token")
+	assert.NoError(t, err)
+
+	want := gitCredentials{
+		http: []httpCredentials{
+			{username: "oauth2", token: "glpat-token", scope: "https://gitlab.example.com"},
+			{username: "x-access-token", token: "ghp_token", scope: "https://github.com"},
+		},
+	}
+	assert.Equal(t, want, credentials)
+	assert.False(t, credentials.isEmpty())
+	assert.NoError(t, credentials.cleanup())
+}
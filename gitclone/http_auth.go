@@ -0,0 +1,109 @@
+package gitclone
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	httpUsernameEnvPrefix = "GIT_CLONE_HTTP_USERNAME_"
+	httpTokenEnvPrefix    = "GIT_CLONE_HTTP_TOKEN_"
+)
+
+// credentialHelper answers git's credential requests from the environment of the git process,
+// so the token is neither stored in a config file nor visible in the command's arguments.
+func credentialHelper(index int) string {
+	usernameEnv := httpUsernameEnvPrefix + strconv.Itoa(index)
+	tokenEnv := httpTokenEnvPrefix + strconv.Itoa(index)
+
+	return `!f() { test "$1" = get && echo "username=${` + usernameEnv + `}" && echo "password=${` + tokenEnv + `}"; }; f`
+}
+
+// httpCredentials are sent to a single HTTP(S) host
+type httpCredentials struct {
+	username string
+	token    string
+	// scope is the URL (scheme and host) the credentials are sent to
+	scope string
+}
+
+// newHTTPCredentials returns nil if no token is given
+func newHTTPCredentials(username, token, repositoryURL string) (*httpCredentials, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if username == "" {
+		return nil, NewParameterValidationError("HTTP token authentication can not be used: no HTTP username specified")
+	}
+
+	scope, err := credentialScope(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpCredentials{
+		username: username,
+		token:    token,
+		scope:    scope,
+	}, nil
+}
+
+// credentialScope returns the scheme and host of an HTTP(S) repository URL
+func credentialScope(repositoryURL string) (string, error) {
+	u, err := url.Parse(repositoryURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", NewParameterValidationError(fmt.Sprintf("HTTP token authentication can not be used: repository URL (%s) is not an HTTP(S) URL", Redact(repositoryURL)))
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// gitCredentials authenticate the git commands per host: HTTP(S) hosts with a transient credential helper,
+// configured per-command through the GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n> env vars,
+// SSH hosts with a generated ssh config selecting the host's key.
+// Nothing is written to the cloned repository's config.
+type gitCredentials struct {
+	http []httpCredentials
+	// sshConfig is the path of the ssh config mapping the SSH hosts to their keys, empty if there are none
+	sshConfig string
+}
+
+func (c gitCredentials) isEmpty() bool {
+	return len(c.http) == 0 && c.sshConfig == ""
+}
+
+// envs returns the given environment extended with the credential config
+func (c gitCredentials) envs(env []string) []string {
+	var config []gitConfigEntry
+	var extra []string
+	for i, creds := range c.http {
+		key := "credential." + creds.scope + ".helper"
+		// An empty helper resets the list of helpers configured for the URL so far (for example a credential store),
+		// so the token is not saved by them either.
+		config = append(config, gitConfigEntry{key, ""}, gitConfigEntry{key, credentialHelper(i)})
+		extra = append(extra,
+			httpUsernameEnvPrefix+strconv.Itoa(i)+"="+creds.username,
+			httpTokenEnvPrefix+strconv.Itoa(i)+"="+creds.token,
+		)
+	}
+
+	extended := append(withGitConfig(env, config), extra...)
+	if c.sshConfig != "" {
+		// Keep the SSH command passed in the environment by the user
+		sshCommand := "ssh"
+		if value := envValue(extended, "GIT_SSH_COMMAND"); value != "" {
+			sshCommand = value
+		}
+		// The SSH command is run by the shell, the config path may contain spaces (from $TMPDIR)
+		extended = append(extended, fmt.Sprintf("GIT_SSH_COMMAND=%s -F %s", sshCommand, shellQuote(c.sshConfig)))
+	}
+
+	return extended
+}
+
+// shellQuote quotes the value as a single shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,143 @@
+package gitclone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newHTTPCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		username      string
+		token         string
+		repositoryURL string
+		want          *httpCredentials
+		wantErr       bool
+	}{
+		{
+			name:          "no token",
+			repositoryURL: "https://github.com/bitrise-io/git-clone.git",
+		},
+		{
+			name:          "HTTPS URL",
+			username:      "x-access-token",
+			token:         "ghp_token",
+			repositoryURL: "https://github.com/bitrise-io/git-clone.git",
+			want:          &httpCredentials{username: "x-access-token", token: "ghp_token", scope: "https://github.com"},
+		},
+		{
+			name:          "HTTP URL with port",
+			username:      "oauth2",
+			token:         "glpat-token",
+			repositoryURL: "http://gitlab.example.com:8080/group/project.git",
+			want:          &httpCredentials{username: "oauth2", token: "glpat-token", scope: "http://gitlab.example.com:8080"},
+		},
+		{
+			name:          "no username",
+			token:         "ghp_token",
+			repositoryURL: "https://github.com/bitrise-io/git-clone.git",
+			wantErr:       true,
+		},
+		{
+			name:          "SSH URL",
+			username:      "x-access-token",
+			token:         "ghp_token",
+			repositoryURL: "git@github.com:bitrise-io/git-clone.git",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newHTTPCredentials(tt.username, tt.token, tt.repositoryURL)
+			if tt.wantErr {
+				assert.IsType(t, ParameterValidationError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_gitCredentials_envs(t *testing.T) {
+	c := gitCredentials{
+		http: []httpCredentials{
+			{username: "oauth2", token: "glpat-token", scope: "https://gitlab.example.com"},
+			{username: "user", token: "token", scope: "https://github.com"},
+		},
+		sshConfig: "/tmp/my temp/git-clone-ssh/ssh_config",
+	}
+
+	got := c.envs([]string{"HOME=/home/user", "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.sslVerify", "GIT_CONFIG_VALUE_0=false"})
+
+	want := []string{
+		"HOME=/home/user",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.sslVerify",
+		"GIT_CONFIG_VALUE_0=false",
+		"GIT_CONFIG_KEY_1=credential.https://gitlab.example.com.helper",
+		"GIT_CONFIG_VALUE_1=",
+		"GIT_CONFIG_KEY_2=credential.https://gitlab.example.com.helper",
+		"GIT_CONFIG_VALUE_2=" + credentialHelper(0),
+		"GIT_CONFIG_KEY_3=credential.https://github.com.helper",
+		"GIT_CONFIG_VALUE_3=",
+		"GIT_CONFIG_KEY_4=credential.https://github.com.helper",
+		"GIT_CONFIG_VALUE_4=" + credentialHelper(1),
+		"GIT_CONFIG_COUNT=5",
+		"GIT_CLONE_HTTP_USERNAME_0=oauth2",
+		"GIT_CLONE_HTTP_TOKEN_0=glpat-token",
+		"GIT_CLONE_HTTP_USERNAME_1=user",
+		"GIT_CLONE_HTTP_TOKEN_1=token",
+		"GIT_SSH_COMMAND=ssh -F '/tmp/my temp/git-clone-ssh/ssh_config'",
+	}
+	assert.Equal(t, want, got)
+}
+
+func Test_checkGitConfigEnvSupport(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{
+		{name: "supported", version: "git version 2.31.0"},
+		{name: "newer", version: "git version 2.39.2 (Apple Git-143)"},
+		{name: "next major", version: "git version 3.0.0"},
+		{name: "too old", version: "git version 2.30.9", wantErr: true},
+		{name: "unknown", version: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkGitConfigEnvSupport(tt.version, logger{})
+			assert.Equal(t, tt.wantErr, err != nil, "checkGitConfigEnvSupport(, logger{}) error = %v", err)
+		})
+	}
+}
+
+func Test_envRunner_credentialFill(t *testing.T) {
+	r := envRunner{
+		runner: DefaultRunner{},
+		envs: []commandEnv{
+			gitCredentials{
+				http: []httpCredentials{
+					{username: "user", token: "s3cr3t", scope: "https://github.com"},
+					{username: "oauth2", token: "glpat-token", scope: "https://gitlab.example.com"},
+				},
+			},
+		},
+	}
+
+	fill := func(host string) string {
+		cmd := command.New("git", "credential", "fill").
+			SetStdin(strings.NewReader("protocol=https\nhost="+host+"\n\n")).
+			AppendEnvs("GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=")
+		out, _ := r.RunForOutput(cmd)
+		return out
+	}
+
+	assert.Contains(t, fill("github.com"), "username=user\npassword=s3cr3t")
+	assert.Contains(t, fill("gitlab.example.com"), "username=oauth2\npassword=glpat-token")
+	assert.NotContains(t, fill("gitlab.com"), "s3cr3t")
+}
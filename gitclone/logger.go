@@ -0,0 +1,71 @@
+package gitclone
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// logger prints the log messages of a clone process to its output, with the same colors as the go-utils log package.
+// Without an output the messages are printed by the go-utils log package.
+type logger struct {
+	w io.Writer
+	// secrets are masked in the messages
+	secrets secrets
+}
+
+func (l logger) println(colorf colorstring.ColorfFunc, logf func(string, ...interface{}), format string, v ...interface{}) {
+	msg := l.secrets.mask(fmt.Sprintf(format, v...))
+	if l.w == nil {
+		logf("%s", msg)
+		return
+	}
+
+	if _, err := fmt.Fprintln(l.w, colorf("%s", msg)); err != nil {
+		fmt.Printf("failed to print message: %s, error: %s\n", msg, err)
+	}
+}
+
+// Infof ...
+func (l logger) Infof(format string, v ...interface{}) {
+	l.println(colorstring.Bluef, log.Infof, format, v...)
+}
+
+// Printf ...
+func (l logger) Printf(format string, v ...interface{}) {
+	l.println(colorstring.NoColorf, log.Printf, format, v...)
+}
+
+// Donef ...
+func (l logger) Donef(format string, v ...interface{}) {
+	l.println(colorstring.Greenf, log.Donef, format, v...)
+}
+
+// Warnf ...
+func (l logger) Warnf(format string, v ...interface{}) {
+	l.println(colorstring.Yellowf, log.Warnf, format, v...)
+}
+
+// Errorf ...
+func (l logger) Errorf(format string, v ...interface{}) {
+	l.println(colorstring.Redf, log.Errorf, format, v...)
+}
+
+// stdout receives the output printed without a log level, like the output of the commands
+func (l logger) stdout() io.Writer {
+	if l.w == nil {
+		return os.Stdout
+	}
+	return l.w
+}
+
+// stderr receives the error output of the commands
+func (l logger) stderr() io.Writer {
+	if l.w == nil {
+		return os.Stderr
+	}
+	return l.w
+}
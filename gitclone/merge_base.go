@@ -0,0 +1,54 @@
+package gitclone
+
+// mergeRef is a ref fetched from a remote for merging
+type mergeRef struct {
+	remote string
+	// ref is the fetched refspec
+	ref string
+	// rev is the revision name of the fetched ref in the local repository
+	rev string
+}
+
+func hasMergeBase(gitCmd gitRunner, revA, revB string) bool {
+	// Exits with 1 if there is no common ancestor, and fails if either revision is missing
+	_, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "merge-base", revA, revB))
+	return err == nil
+}
+
+// deepenUntilMergeBase deepens the history of both shallow fetched refs (doubling the depth each time)
+// until they have a common ancestor, so they can be merged without fetching the full history.
+// If no common ancestor is found within maxDepth, the merge fallback is left to fetch the full history.
+func deepenUntilMergeBase(gitCmd gitRunner, fetchOpts fetchOptions, maxDepth int, refA, refB mergeRef) error {
+	if fetchOpts.IsFullDepth() {
+		return nil
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultUnshallowMaxDepth
+	}
+
+	depth := fetchOpts.depth
+	for !hasMergeBase(gitCmd, refA.rev, refB.rev) {
+		if depth >= maxDepth {
+			gitCmd.log.Warnf("No common ancestor of %s and %s found within %d commits", refA.rev, refB.rev, maxDepth)
+			return nil
+		}
+
+		deepenBy := depth
+		if depth+deepenBy > maxDepth {
+			deepenBy = maxDepth - depth
+		}
+
+		gitCmd.log.Infof("No common ancestor of %s and %s yet, deepening history by %d commits (to depth %d)...", refA.rev, refB.rev, deepenBy, depth+deepenBy)
+		deepenOpts := fetchOpts
+		deepenOpts.depth = 0
+		deepenOpts.deepen = deepenBy
+		for _, ref := range []mergeRef{refA, refB} {
+			if err := fetch(gitCmd, ref.remote, ref.ref, deepenOpts); err != nil {
+				return err
+			}
+		}
+		depth += deepenBy
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package gitclone
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	phaseFetch           = "fetch"
+	phaseCheckout        = "checkout"
+	phaseMerge           = "merge"
+	phaseSubmoduleUpdate = "submodule_update"
+	phaseOther           = "other"
+)
+
+// phases in the order of the summary
+var phases = []string{phaseFetch, phaseCheckout, phaseMerge, phaseSubmoduleUpdate, phaseOther}
+
+// PhaseMetrics are the aggregated metrics of the commands run in a phase
+type PhaseMetrics struct {
+	Phase    string `json:"phase"`
+	Commands int    `json:"commands"`
+	// Wall-time in milliseconds
+	Duration int64 `json:"duration_ms"`
+	// Bytes received from the remote, as reported by git's transfer progress.
+	// Small fetches unpacked into loose objects may not report progress, these are counted as 0.
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+type cloneMetrics struct {
+	byPhase map[string]*PhaseMetrics
+}
+
+func newCloneMetrics() *cloneMetrics {
+	return &cloneMetrics{byPhase: map[string]*PhaseMetrics{}}
+}
+
+func (m *cloneMetrics) add(phase string, duration time.Duration, bytesReceived int64) {
+	p, ok := m.byPhase[phase]
+	if !ok {
+		p = &PhaseMetrics{Phase: phase}
+		m.byPhase[phase] = p
+	}
+
+	p.Commands++
+	p.Duration += duration.Milliseconds()
+	p.BytesReceived += bytesReceived
+}
+
+// summary returns the metrics of the phases with at least one command run
+func (m *cloneMetrics) summary() []PhaseMetrics {
+	var summary []PhaseMetrics
+	for _, phase := range phases {
+		if p, ok := m.byPhase[phase]; ok {
+			summary = append(summary, *p)
+		}
+	}
+	return summary
+}
+
+func (m *cloneMetrics) total() PhaseMetrics {
+	return totalMetrics(m.summary())
+}
+
+func totalMetrics(phases []PhaseMetrics) PhaseMetrics {
+	total := PhaseMetrics{Phase: "total"}
+	for _, p := range phases {
+		total.Commands += p.Commands
+		total.Duration += p.Duration
+		total.BytesReceived += p.BytesReceived
+	}
+	return total
+}
+
+func (m *cloneMetrics) print(output io.Writer) {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Phase\tCommands\tDuration\tReceived")
+	for _, p := range append(m.summary(), m.total()) {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", p.Phase, p.Commands, time.Duration(p.Duration)*time.Millisecond, formatBytes(p.BytesReceived))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(output, err)
+	}
+}
+
+// metricsOutputs are the metrics env vars exported as Step outputs, in the order of the Step definition.
+// The received bytes are only exported for the phases fetching from the remote.
+var metricsOutputs = []string{
+	"GIT_CLONE_FETCH_DURATION_MS",
+	"GIT_CLONE_FETCH_BYTES_RECEIVED",
+	"GIT_CLONE_CHECKOUT_DURATION_MS",
+	"GIT_CLONE_MERGE_DURATION_MS",
+	"GIT_CLONE_SUBMODULE_UPDATE_DURATION_MS",
+	"GIT_CLONE_SUBMODULE_UPDATE_BYTES_RECEIVED",
+	"GIT_CLONE_TOTAL_DURATION_MS",
+	"GIT_CLONE_TOTAL_BYTES_RECEIVED",
+}
+
+// metricsEnvs returns the env vars of the phase metrics, the phases without a command run are reported as zero
+func metricsEnvs(summary []PhaseMetrics) map[string]string {
+	byPhase := map[string]PhaseMetrics{}
+	for _, p := range summary {
+		byPhase[p.Phase] = p
+	}
+
+	all := []PhaseMetrics{}
+	for _, phase := range phases {
+		p, ok := byPhase[phase]
+		if !ok {
+			p = PhaseMetrics{Phase: phase}
+		}
+		all = append(all, p)
+	}
+
+	envs := map[string]string{}
+	for _, p := range append(all, totalMetrics(summary)) {
+		prefix := "GIT_CLONE_" + strings.ToUpper(p.Phase)
+		envs[prefix+"_DURATION_MS"] = strconv.FormatInt(p.Duration, 10)
+		envs[prefix+"_BYTES_RECEIVED"] = strconv.FormatInt(p.BytesReceived, 10)
+	}
+	return envs
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// commandPhase classifies a git command by its subcommand
+func commandPhase(c *command.Model) string {
+	args := c.GetCmd().Args
+	if len(args) < 2 {
+		return phaseOther
+	}
+
+	switch args[1] {
+	case "fetch":
+		return phaseFetch
+	case "checkout":
+		return phaseCheckout
+	case "merge", "apply":
+		return phaseMerge
+	case "submodule":
+		if len(args) > 2 && args[2] == "update" {
+			return phaseSubmoduleUpdate
+		}
+	}
+	return phaseOther
+}
+
+func isTransferPhase(phase string) bool {
+	return phase == phaseFetch || phase == phaseSubmoduleUpdate
+}
+
+// Receiving objects:  45% (5/11), 1.20 MiB | 2.40 MiB/s
+// Receiving objects: 100% (11/11), 2.71 MiB | 2.40 MiB/s, done.
+// Small packs (below fetch.unpackLimit objects) are unpacked into loose objects:
+// Unpacking objects: 100% (13/13), 2.86 MiB | 9.51 MiB/s, done.
+var receivingObjectsPattern = regexp.MustCompile(`(?:Receiving|Unpacking) objects:\s+\d+% \(\d+/\d+\), (\d+(?:\.\d+)?) (bytes?|KiB|MiB|GiB)(.*)`)
+
+// parseProgressSize returns the size reported by git's transfer progress in bytes, for example 1.20 MiB
+func parseProgressSize(value, unit string) int64 {
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+
+	switch unit {
+	case "KiB":
+		size *= 1 << 10
+	case "MiB":
+		size *= 1 << 20
+	case "GiB":
+		size *= 1 << 30
+	}
+	return int64(size)
+}
+
+// transferCounter sums the bytes received from the "Receiving objects" and "Unpacking objects" progress lines written to it.
+// A command may receive more than one pack (for example the parallel submodule clones), each is reported to be done by a final progress line.
+type transferCounter struct {
+	line []byte
+	// done is the size of the received packs
+	done int64
+	// current is the size of the pack being received
+	current int64
+}
+
+func (t *transferCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			t.line = append(t.line, b)
+			continue
+		}
+
+		t.parseLine(string(t.line))
+		t.line = t.line[:0]
+	}
+	return len(p), nil
+}
+
+func (t *transferCounter) parseLine(line string) {
+	match := receivingObjectsPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	size := parseProgressSize(match[1], match[2])
+	if strings.Contains(match[3], "done") {
+		t.done += size
+		t.current = 0
+	} else {
+		t.current = size
+	}
+}
+
+// received returns the bytes received, including the pack being received if the command was interrupted
+func (t *transferCounter) received() int64 {
+	if len(bytes.TrimSpace(t.line)) != 0 {
+		t.parseLine(string(t.line))
+		t.line = t.line[:0]
+	}
+	return t.done + t.current
+}
+
+// metricsRunner records the wall-time and the received bytes of the commands run through the wrapped CommandRunner.
+// The received bytes are parsed from git's transfer progress, which is written to the transferCounter set as the command's stderr
+// (DefaultRunner writes the output to it too). Git only reports progress with the --progress flag when the output is not a terminal.
+type metricsRunner struct {
+	runner  CommandRunner
+	metrics *cloneMetrics
+}
+
+// measurement is a command being measured
+type measurement struct {
+	phase    string
+	transfer *transferCounter
+	start    time.Time
+}
+
+func (r metricsRunner) start(c *command.Model) measurement {
+	m := measurement{
+		phase:    commandPhase(c),
+		transfer: &transferCounter{},
+		start:    time.Now(),
+	}
+	m.observe(c)
+
+	return m
+}
+
+// observe counts the bytes received by the command
+func (m measurement) observe(c *command.Model) *command.Model {
+	if isTransferPhase(m.phase) {
+		c.SetStderr(m.transfer)
+	}
+	return c
+}
+
+func (r metricsRunner) finish(m measurement) {
+	r.metrics.add(m.phase, time.Since(m.start), m.transfer.received())
+}
+
+// RunForOutput ...
+func (r metricsRunner) RunForOutput(c *command.Model) (string, error) {
+	m := r.start(c)
+	out, err := r.runner.RunForOutput(c)
+	r.finish(m)
+
+	return out, err
+}
+
+// Run ...
+func (r metricsRunner) Run(c *command.Model) error {
+	m := r.start(c)
+	err := r.runner.Run(c)
+	r.finish(m)
+
+	return err
+}
+
+// RunWithRetry ...
+func (r metricsRunner) RunWithRetry(getCommand func() *command.Model) error {
+	// The bytes received by every attempt are counted
+	var m *measurement
+	err := r.runner.RunWithRetry(func() *command.Model {
+		c := getCommand()
+		if m == nil {
+			started := r.start(c)
+			m = &started
+			return c
+		}
+
+		return m.observe(c)
+	})
+	if m != nil {
+		r.finish(*m)
+	}
+
+	return err
+}
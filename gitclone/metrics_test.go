@@ -0,0 +1,132 @@
+package gitclone
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/command/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_commandPhase(t *testing.T) {
+	gitCmd := git.Git{}
+	tests := []struct {
+		name string
+		cmd  *command.Model
+		want string
+	}{
+		{name: "fetch", cmd: gitCmd.Fetch("--jobs=10"), want: phaseFetch},
+		{name: "checkout", cmd: gitCmd.Checkout("master"), want: phaseCheckout},
+		{name: "merge", cmd: gitCmd.Merge("pull/5"), want: phaseMerge},
+		{name: "apply", cmd: gitCmd.Apply("diff.txt"), want: phaseMerge},
+		{name: "submodule update", cmd: gitCmd.SubmoduleUpdate(false), want: phaseSubmoduleUpdate},
+		{name: "submodule foreach", cmd: gitCmd.SubmoduleForeach(gitCmd.Clean("-f")), want: phaseOther},
+		{name: "log", cmd: gitCmd.Log("%H"), want: phaseOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, commandPhase(tt.cmd))
+		})
+	}
+}
+
+func Test_cloneMetrics(t *testing.T) {
+	metrics := newCloneMetrics()
+	metrics.add(phaseCheckout, 200*time.Millisecond, 0)
+	metrics.add(phaseFetch, time.Second, 2048)
+	metrics.add(phaseFetch, 500*time.Millisecond, 1024)
+
+	assert.Equal(t, []PhaseMetrics{
+		{Phase: phaseFetch, Commands: 2, Duration: 1500, BytesReceived: 3072},
+		{Phase: phaseCheckout, Commands: 1, Duration: 200},
+	}, metrics.summary())
+	assert.Equal(t, PhaseMetrics{Phase: "total", Commands: 3, Duration: 1700, BytesReceived: 3072}, metrics.total())
+	assert.Equal(t, map[string]string{
+		"GIT_CLONE_FETCH_DURATION_MS":               "1500",
+		"GIT_CLONE_FETCH_BYTES_RECEIVED":            "3072",
+		"GIT_CLONE_CHECKOUT_DURATION_MS":            "200",
+		"GIT_CLONE_CHECKOUT_BYTES_RECEIVED":         "0",
+		"GIT_CLONE_MERGE_DURATION_MS":               "0",
+		"GIT_CLONE_MERGE_BYTES_RECEIVED":            "0",
+		"GIT_CLONE_SUBMODULE_UPDATE_DURATION_MS":    "0",
+		"GIT_CLONE_SUBMODULE_UPDATE_BYTES_RECEIVED": "0",
+		"GIT_CLONE_OTHER_DURATION_MS":               "0",
+		"GIT_CLONE_OTHER_BYTES_RECEIVED":            "0",
+		"GIT_CLONE_TOTAL_DURATION_MS":               "1700",
+		"GIT_CLONE_TOTAL_BYTES_RECEIVED":            "3072",
+	}, metricsEnvs(metrics.summary()))
+}
+
+func Test_metricsRunner(t *testing.T) {
+	// Given
+	gitCmd := git.Git{}
+	receivePack := func(args mock.Arguments) {
+		c := args.Get(0).(func() *command.Model)()
+		_, err := io.WriteString(c.GetCmd().Stderr, "Receiving objects:  50% (5/10), 2.00 KiB | 1.00 MiB/s\rReceiving objects: 100% (10/10), 4.00 KiB | 1.00 MiB/s, done.\n")
+		assert.NoError(t, err)
+	}
+	mockRunner := givenMockRunner().GivenRunSucceeds()
+	mockRunner.On("RunWithRetry", mock.Anything).Run(receivePack).Return(nil)
+	metrics := newCloneMetrics()
+	runner := metricsRunner{runner: mockRunner, metrics: metrics}
+
+	// When
+	assert.NoError(t, runner.RunWithRetry(func() *command.Model { return gitCmd.Fetch("--progress") }))
+	assert.NoError(t, runner.Run(gitCmd.Checkout("master")))
+
+	// Then
+	summary := metrics.summary()
+	assert.Equal(t, 2, len(summary))
+	assert.Equal(t, PhaseMetrics{Phase: phaseFetch, Commands: 1, Duration: summary[0].Duration, BytesReceived: 4096}, summary[0])
+	assert.Equal(t, PhaseMetrics{Phase: phaseCheckout, Commands: 1, Duration: summary[1].Duration}, summary[1])
+}
+
+func Test_transferCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   int64
+	}{
+		{
+			name:   "Single pack",
+			output: "remote: Enumerating objects: 10, done.\nReceiving objects:  50% (5/10), 1.50 MiB | 1.00 MiB/s\rReceiving objects: 100% (10/10), 3.00 MiB | 1.00 MiB/s, done.\nResolving deltas: 100% (2/2), done.\n",
+			want:   3 << 20,
+		},
+		{
+			name:   "Parallel submodule clones",
+			output: "Unpacking objects: 100% (3/3), 512 bytes | 512.00 KiB/s, done.\nReceiving objects: 100% (7/7), 1.00 KiB | 1.00 MiB/s, done.\n",
+			want:   512 + 1024,
+		},
+		{
+			name:   "Interrupted transfer",
+			output: "Receiving objects:  12% (12/100), 1.25 GiB | 10.00 MiB/s",
+			want:   int64(1.25 * (1 << 30)),
+		},
+		{
+			name:   "No transfer",
+			output: "From https://github.com/bitrise-io/git-clone-test\n * branch master -> FETCH_HEAD\n",
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &transferCounter{}
+			// Written in two parts to split a progress line
+			_, err := counter.Write([]byte(tt.output[:len(tt.output)/2]))
+			assert.NoError(t, err)
+			_, err = counter.Write([]byte(tt.output[len(tt.output)/2:]))
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.want, counter.received())
+		})
+	}
+}
+
+func Test_formatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "45.6 MiB", formatBytes(47815065))
+}
@@ -33,6 +33,27 @@ func (m *MockRunner) GivenRunForOutputSucceeds() *MockRunner {
 	return m
 }
 
+// GivenRunForOutputFailsForCommand ...
+func (m *MockRunner) GivenRunForOutputFailsForCommand(cmdString string, times int) *MockRunner {
+	m.On("RunForOutput", mock.MatchedBy(func(command *command.Model) bool {
+		return m.isCommandMatching(command, cmdString)
+	})).
+		Run(m.rememberCommand).
+		Times(times).
+		Return("", errDummy)
+	return m
+}
+
+// GivenRunForOutputSucceedsForCommand ...
+func (m *MockRunner) GivenRunForOutputSucceedsForCommand(cmdString, output string) *MockRunner {
+	m.On("RunForOutput", mock.MatchedBy(func(command *command.Model) bool {
+		return m.isCommandMatching(command, cmdString)
+	})).
+		Run(m.rememberCommand).
+		Return(output, nil)
+	return m
+}
+
 // Run ...
 func (m *MockRunner) Run(c *command.Model) error {
 	args := m.Called(c)
@@ -58,6 +79,17 @@ func (m *MockRunner) GivenRunFailsForCommand(cmdString string, times int) *MockR
 	return m
 }
 
+// GivenRunFailsForCommandWithError ...
+func (m *MockRunner) GivenRunFailsForCommandWithError(cmdString string, err error, times int) *MockRunner {
+	m.On("Run", mock.MatchedBy(func(command *command.Model) bool {
+		return m.isCommandMatching(command, cmdString)
+	})).
+		Run(m.rememberCommand).
+		Times(times).
+		Return(err)
+	return m
+}
+
 // RunWithRetry ...
 func (m *MockRunner) RunWithRetry(getCommand func() *command.Model) error {
 	args := m.Called(getCommand)
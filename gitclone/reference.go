@@ -0,0 +1,97 @@
+package gitclone
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const referenceRepositoryFailedTag = "reference_repository_failed"
+
+func alternatesPath(cloneIntoDir string) string {
+	return filepath.Join(cloneIntoDir, ".git", "objects", "info", "alternates")
+}
+
+// referenceObjectsDir returns the object directory of a bare (mirror) or a non-bare reference repository,
+// or an empty string if the directory is not a git repository.
+func referenceObjectsDir(referenceDir string) (string, error) {
+	absDir, err := pathutil.AbsPath(referenceDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, objectsDir := range []string{
+		filepath.Join(absDir, "objects"),
+		filepath.Join(absDir, ".git", "objects"),
+	} {
+		if exist, err := pathutil.IsDirExists(objectsDir); err != nil {
+			return "", err
+		} else if exist {
+			return objectsDir, nil
+		}
+	}
+
+	return "", nil
+}
+
+// setupReferenceRepository registers the reference repository's object directory as an alternate object store,
+// so fetch only transfers the objects missing from the reference repository (like `git clone --reference-if-able`).
+// Returns false if the reference repository is not available.
+func setupReferenceRepository(cloneIntoDir, referenceDir string, log logger) (bool, error) {
+	objectsDir, err := referenceObjectsDir(referenceDir)
+	if err != nil {
+		return false, err
+	}
+	if objectsDir == "" {
+		log.Warnf("Reference repository (%s) is not available, fetching without it", referenceDir)
+		return false, nil
+	}
+
+	pth := alternatesPath(cloneIntoDir)
+	var alternates []string
+	if exist, err := pathutil.IsPathExists(pth); err != nil {
+		return false, err
+	} else if exist {
+		content, err := fileutil.ReadStringFromFile(pth)
+		if err != nil {
+			return false, err
+		}
+		alternates = strings.Fields(content)
+	}
+
+	for _, alternate := range alternates {
+		if alternate == objectsDir {
+			log.Printf("Reference repository (%s) is already used", referenceDir)
+			return true, nil
+		}
+	}
+	alternates = append(alternates, objectsDir)
+
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		return false, err
+	}
+	if err := fileutil.WriteStringToFile(pth, strings.Join(alternates, "\n")+"\n"); err != nil {
+		return false, err
+	}
+
+	log.Printf("Using reference repository: %s", objectsDir)
+	return true, nil
+}
+
+// dissociateReferenceRepository copies the borrowed objects into the repository and stops using the reference repository
+// (like `git clone --dissociate`).
+func dissociateReferenceRepository(gitCmd gitRunner, cloneIntoDir string) error {
+	if err := gitCmd.runner.Run(gitCommand(gitCmd, "repack", "-a", "-d")); err != nil {
+		return fmt.Errorf("repack failed: %v", err)
+	}
+
+	if err := os.Remove(alternatesPath(cloneIntoDir)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove alternates file: %v", err)
+	}
+
+	return nil
+}
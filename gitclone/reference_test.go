@@ -0,0 +1,94 @@
+package gitclone
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_setupReferenceRepository(t *testing.T) {
+	mirrorDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(mirrorDir, "objects"), 0755))
+
+	workingTreeDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(workingTreeDir, ".git", "objects"), 0755))
+
+	tests := []struct {
+		name           string
+		referenceDirs  []string
+		want           bool
+		wantAlternates string
+	}{
+		{
+			name:           "Mirror repository",
+			referenceDirs:  []string{mirrorDir},
+			want:           true,
+			wantAlternates: filepath.Join(mirrorDir, "objects") + "\n",
+		},
+		{
+			name:           "Non-bare repository",
+			referenceDirs:  []string{workingTreeDir},
+			want:           true,
+			wantAlternates: filepath.Join(workingTreeDir, ".git", "objects") + "\n",
+		},
+		{
+			name:           "Reference repository already used",
+			referenceDirs:  []string{mirrorDir, mirrorDir},
+			want:           true,
+			wantAlternates: filepath.Join(mirrorDir, "objects") + "\n",
+		},
+		{
+			name:          "Missing reference repository",
+			referenceDirs: []string{filepath.Join(mirrorDir, "missing")},
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloneIntoDir := t.TempDir()
+
+			var got bool
+			for _, referenceDir := range tt.referenceDirs {
+				var err error
+				got, err = setupReferenceRepository(cloneIntoDir, referenceDir, logger{})
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, got)
+			if tt.wantAlternates == "" {
+				exist, err := pathutil.IsPathExists(alternatesPath(cloneIntoDir))
+				assert.NoError(t, err)
+				assert.False(t, exist)
+			} else {
+				alternates, err := fileutil.ReadStringFromFile(alternatesPath(cloneIntoDir))
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantAlternates, alternates)
+			}
+		})
+	}
+}
+
+func Test_dissociateReferenceRepository(t *testing.T) {
+	// Given
+	referenceDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(referenceDir, "objects"), 0755))
+	cloneIntoDir := t.TempDir()
+	_, err := setupReferenceRepository(cloneIntoDir, referenceDir, logger{})
+	assert.NoError(t, err)
+
+	mockRunner := givenMockRunnerSucceeds()
+
+	// When
+	actualErr := dissociateReferenceRepository(gitRunner{runner: mockRunner}, cloneIntoDir)
+
+	// Then
+	assert.NoError(t, actualErr)
+	assert.Equal(t, []string{`git "repack" "-a" "-d"`}, mockRunner.Cmds())
+	exist, err := pathutil.IsPathExists(alternatesPath(cloneIntoDir))
+	assert.NoError(t, err)
+	assert.False(t, exist)
+}
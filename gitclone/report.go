@@ -0,0 +1,160 @@
+package gitclone
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	reportFileName = "git_clone_report.json"
+	reportPathEnv  = "GIT_CLONE_REPORT_PATH"
+)
+
+// cloneReport is the machine-readable summary of the clone process
+type cloneReport struct {
+	CheckoutMethod     string          `json:"checkout_method"`
+	CheckoutStrategy   string          `json:"checkout_strategy"`
+	CheckoutDecisions  []string        `json:"checkout_decisions"`
+	Depth              int             `json:"depth"`
+	Filter             string          `json:"filter,omitempty"`
+	SparseDirectories  []string        `json:"sparse_directories,omitempty"`
+	Fallback           string          `json:"fallback,omitempty"`
+	FallbacksTriggered []string        `json:"fallbacks_triggered"`
+	Commands           []commandReport `json:"commands"`
+	Phases             []PhaseMetrics  `json:"phases"`
+	Head               string          `json:"head,omitempty"`
+	Submodules         []SubmoduleInfo `json:"submodules,omitempty"`
+	Error              string          `json:"error,omitempty"`
+}
+
+type commandReport struct {
+	Command string `json:"command"`
+	// Duration of all attempts in milliseconds
+	Duration int64 `json:"duration_ms"`
+	Attempts int   `json:"attempts"`
+	// Exit status of the last attempt, -1 if the command did not exit normally
+	ExitStatus int `json:"exit_status"`
+}
+
+func newCloneReport() *cloneReport {
+	return &cloneReport{
+		FallbacksTriggered: []string{},
+		Commands:           []commandReport{},
+	}
+}
+
+func (r *cloneReport) addCommand(cmd string, start time.Time, attempts int, err error) {
+	r.Commands = append(r.Commands, commandReport{
+		Command:    Redact(cmd),
+		Duration:   time.Since(start).Milliseconds(),
+		Attempts:   attempts,
+		ExitStatus: exitCode(err),
+	})
+}
+
+// reportingRunner records every command run through the wrapped CommandRunner
+type reportingRunner struct {
+	runner CommandRunner
+	report *cloneReport
+}
+
+// RunForOutput ...
+func (r reportingRunner) RunForOutput(c *command.Model) (string, error) {
+	start := time.Now()
+	out, err := r.runner.RunForOutput(c)
+	r.report.addCommand(c.PrintableCommandArgs(), start, 1, err)
+
+	return out, err
+}
+
+// Run ...
+func (r reportingRunner) Run(c *command.Model) error {
+	start := time.Now()
+	err := r.runner.Run(c)
+	r.report.addCommand(c.PrintableCommandArgs(), start, 1, err)
+
+	return err
+}
+
+// RunWithRetry ...
+func (r reportingRunner) RunWithRetry(getCommand func() *command.Model) error {
+	var cmd string
+	attempts := 0
+	start := time.Now()
+	err := r.runner.RunWithRetry(func() *command.Model {
+		c := getCommand()
+		cmd = c.PrintableCommandArgs()
+		attempts++
+
+		return c
+	})
+	r.report.addCommand(cmd, start, attempts, err)
+
+	return err
+}
+
+// fallbackName is the name of the fallback in the report, for example simpleUnshallow
+func fallbackName(fallback fallbackRetry) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", fallback), "gitclone.")
+}
+
+// reportedFallback records in the report when the wrapped fallback is triggered
+type reportedFallback struct {
+	fallback fallbackRetry
+	report   *cloneReport
+}
+
+func (f reportedFallback) record() {
+	f.report.FallbacksTriggered = append(f.report.FallbacksTriggered, fallbackName(f.fallback))
+}
+
+func (f reportedFallback) do(gitCmd gitRunner) error {
+	f.record()
+	return f.fallback.do(gitCmd)
+}
+
+func (f reportedFallback) doWithRetry(gitCmd gitRunner, retry func() error) error {
+	f.record()
+	return retryWithFallback(gitCmd, f.fallback, retry)
+}
+
+func collectCheckedOutState(gitCmd gitRunner, report *cloneReport, submodules bool) error {
+	head, err := gitCmd.runner.RunForOutput(gitCmd.RevParse("HEAD"))
+	if err != nil {
+		return fmt.Errorf("rev-parse HEAD failed: %v", err)
+	}
+	report.Head = head
+
+	if submodules {
+		if report.Submodules, err = collectSubmoduleState(gitCmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeReport writes the report to a temporary directory, and returns its path
+func writeReport(report *cloneReport) (string, error) {
+	return writeTempJSONFile("git-clone-report", reportFileName, report)
+}
+
+func writeTempJSONFile(tmpDirPrefix, fileName string, v interface{}) (string, error) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath(tmpDirPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	pth := filepath.Join(tmpDir, fileName)
+	if err := fileutil.WriteJSONToFile(pth, v); err != nil {
+		return "", err
+	}
+
+	return pth, nil
+}
@@ -0,0 +1,53 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkoutState_report(t *testing.T) {
+	// Given
+	report := newCloneReport()
+	runner := reportingRunner{
+		runner: givenMockRunner().
+			GivenRunFailsForCommand(`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`, 1).
+			GivenRunWithRetrySucceedsAfter(1).
+			GivenRunSucceeds(),
+		report: report,
+	}
+	cfg := Config{
+		Commit:            "cfba2b01332e31cb1568dbf3f22edce063118bae",
+		CloneDepth:        1,
+		CloneFilter:       "blob:none",
+		SparseDirectories: []string{"client/android"},
+	}
+
+	// When
+	err := checkoutState(gitRunner{runner: runner}, cfg, nil, report)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", report.CheckoutMethod)
+	assert.Equal(t, "gitclone.checkoutCommit", report.CheckoutStrategy)
+	assert.Equal(t, 1, report.Depth)
+	assert.Equal(t, "blob:none", report.Filter)
+	assert.Equal(t, []string{"client/android"}, report.SparseDirectories)
+	assert.Equal(t, []string{"simpleUnshallow"}, report.FallbacksTriggered)
+
+	var cmds []string
+	var attempts, exitStatuses []int
+	for _, cmd := range report.Commands {
+		cmds = append(cmds, cmd.Command)
+		attempts = append(attempts, cmd.Attempts)
+		exitStatuses = append(exitStatuses, cmd.ExitStatus)
+	}
+	assert.Equal(t, []string{
+		`git "fetch" "--jobs=10" "--depth=1" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress"`,
+		`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+		`git "fetch" "--jobs=10" "--unshallow" "--filter=blob:none" "--no-tags" "--no-recurse-submodules" "--progress"`,
+		`git "checkout" "cfba2b01332e31cb1568dbf3f22edce063118bae"`,
+	}, cmds)
+	assert.Equal(t, []int{2, 1, 2, 1}, attempts)
+	assert.Equal(t, []int{0, -1, 0, 0}, exitStatuses)
+}
@@ -0,0 +1,148 @@
+package gitclone
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	schemeSSH  = "ssh"
+	schemeFile = "file"
+)
+
+// repositoryURL is a parsed git repository URL, see https://git-scm.com/docs/git-clone#_git_urls
+type repositoryURL struct {
+	// Scheme is the transport protocol, scp-like URLs (user@host:path) use ssh, local paths use file
+	Scheme string
+	User   string
+	Host   string
+	Port   string
+	// Owner is the path of the repository without its name (for example the organization or the group)
+	Owner string
+	// Name is the repository name without the .git suffix
+	Name string
+}
+
+// parseRepositoryURL parses the URL formats supported by git:
+// - <scheme>://[<user>[:<password>]@]<host>[:<port>]/<path> (ssh, git, http, https, ftp, ftps and file)
+// - scp-like: [<user>@]<host>:<path>
+// - local paths: /<path>, ./<path>, ../<path>
+func parseRepositoryURL(raw string) (repositoryURL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return repositoryURL{}, fmt.Errorf("empty repository URL")
+	}
+
+	if strings.Contains(raw, "://") {
+		return parseSchemeURL(raw)
+	}
+
+	if host, pth, ok := splitSCPLikeURL(raw); ok {
+		u := repositoryURL{Scheme: schemeSSH}
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			u.User, host = host[:i], host[i+1:]
+		}
+		if host == "" {
+			return repositoryURL{}, fmt.Errorf("missing host in repository URL (%s)", Redact(raw))
+		}
+		u.Host = strings.ToLower(host)
+		u.Owner, u.Name = splitRepositoryPath(pth)
+		return u, nil
+	}
+
+	// Windows paths are split at backslashes too, regardless of the current OS
+	u := repositoryURL{Scheme: schemeFile}
+	u.Owner, u.Name = splitRepositoryPath(strings.ReplaceAll(raw, `\`, "/"))
+	return u, nil
+}
+
+func parseSchemeURL(raw string) (repositoryURL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return repositoryURL{}, fmt.Errorf("invalid repository URL (%s): %v", Redact(raw), err)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	switch scheme {
+	case "git+ssh", "ssh+git":
+		scheme = schemeSSH
+	case schemeSSH, "git", "http", "https", "ftp", "ftps", schemeFile:
+	default:
+		return repositoryURL{}, fmt.Errorf("unsupported repository URL scheme (%s)", parsed.Scheme)
+	}
+
+	u := repositoryURL{
+		Scheme: scheme,
+		Host:   strings.ToLower(parsed.Hostname()),
+		Port:   parsed.Port(),
+	}
+	if parsed.User != nil {
+		u.User = parsed.User.Username()
+	}
+	if u.Host == "" && scheme != schemeFile {
+		return repositoryURL{}, fmt.Errorf("missing host in repository URL (%s)", Redact(raw))
+	}
+
+	u.Owner, u.Name = splitRepositoryPath(parsed.Path)
+	return u, nil
+}
+
+// splitSCPLikeURL splits an scp-like URL to its host (with the user) and path.
+// As git does, it is only scp-like if there is a colon before the first slash,
+// and a single letter host is a Windows drive letter of a local path.
+func splitSCPLikeURL(raw string) (string, string, bool) {
+	colon := strings.Index(raw, ":")
+	if colon <= 0 {
+		return "", "", false
+	}
+	if slash := strings.Index(raw, "/"); slash >= 0 && slash < colon {
+		return "", "", false
+	}
+	if colon == 1 {
+		return "", "", false
+	}
+
+	return raw[:colon], raw[colon+1:], true
+}
+
+// splitRepositoryPath returns the owner path and the name of the repository from the URL's path
+func splitRepositoryPath(pth string) (string, string) {
+	pth = strings.Trim(pth, "/")
+	if pth == "" {
+		return "", ""
+	}
+
+	// ssh://host/~user/repo.git and host:~user/repo.git are relative to the user's home
+	pth = strings.TrimPrefix(pth, "~")
+
+	owner, name := path.Split(pth)
+	return strings.Trim(owner, "/"), strings.TrimSuffix(name, ".git")
+}
+
+// FullName returns the host, owner and name of the repository (for example github.com/bitrise-io/go-utils)
+func (u repositoryURL) FullName() string {
+	parts := []string{u.Host}
+	if u.Owner != "" {
+		parts = append(parts, u.Owner)
+	}
+	return strings.Join(append(parts, u.Name), "/")
+}
+
+// SameRepository reports whether the URLs point to the same repository, regardless of the protocol used to access it
+func (u repositoryURL) SameRepository(other repositoryURL) bool {
+	return strings.EqualFold(u.FullName(), other.FullName())
+}
+
+// RequiresAuthentication reports whether accessing the repository needs credentials:
+// SSH always authenticates, and HTTP(S) URLs with a user embed credentials
+func (u repositoryURL) RequiresAuthentication() bool {
+	switch u.Scheme {
+	case schemeSSH:
+		return true
+	case "http", "https":
+		return u.User != ""
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package gitclone
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// RetryPolicy configures how many times and how long after a failed network operation is retried
+type RetryPolicy struct {
+	// Retries is the number of retries after the first failed attempt
+	Retries uint
+	// Wait is the wait time before the first retry, it is doubled before each further retry
+	Wait time.Duration
+	// MaxWait caps the wait time between the retries, 0 means no cap
+	MaxWait time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	Retries: 2,
+	Wait:    5 * time.Second,
+	MaxWait: 60 * time.Second,
+}
+
+// configRetryPolicy returns the retry policy of the config, the options not set are taken from defaultRetryPolicy
+func configRetryPolicy(cfg Config) (RetryPolicy, error) {
+	policy := defaultRetryPolicy
+	if cfg.RetryCount != nil {
+		if *cfg.RetryCount < 0 {
+			return RetryPolicy{}, fmt.Errorf("retry count (%d) can not be negative", *cfg.RetryCount)
+		}
+		policy.Retries = uint(*cfg.RetryCount)
+	}
+	if cfg.RetryWait != nil {
+		if *cfg.RetryWait < 0 {
+			return RetryPolicy{}, fmt.Errorf("retry wait (%d) can not be negative", *cfg.RetryWait)
+		}
+		policy.Wait = time.Duration(*cfg.RetryWait) * time.Second
+	}
+	if cfg.RetryMaxWait != nil {
+		if *cfg.RetryMaxWait < 0 {
+			return RetryPolicy{}, fmt.Errorf("retry max wait (%d) can not be negative", *cfg.RetryMaxWait)
+		}
+		policy.MaxWait = time.Duration(*cfg.RetryMaxWait) * time.Second
+	}
+	return policy, nil
+}
+
+// waitBefore returns the wait time before the given retry (starting from 1)
+func (p RetryPolicy) waitBefore(retry uint) time.Duration {
+	wait := p.Wait
+	for i := uint(1); i < retry; i++ {
+		if p.MaxWait > 0 && wait >= p.MaxWait {
+			break
+		}
+		// Without a cap the wait time would overflow after ~30 retries
+		if wait > math.MaxInt64/2 {
+			break
+		}
+		wait *= 2
+	}
+
+	if p.MaxWait > 0 && wait > p.MaxWait {
+		return p.MaxWait
+	}
+	return wait
+}
+
+// transientErrorPatterns match the errors of a temporary network or server issue.
+// These are checked first, as some of the fetch error patterns (like unableToAccessPattern) match both transient
+// and permanent errors. Generic messages, like `fatal: Could not read from remote repository`, are not listed,
+// as git prints them after authentication errors too.
+var transientErrorPatterns = compileErrorPatterns(
+	`Connection timed out`,
+	`Connection reset by peer`,
+	`Operation timed out`,
+	`The requested URL returned error: 5\d\d`,
+	`Connection refused`,
+	`early EOF`,
+	`RPC failed`,
+)
+
+// permanentErrorPatterns match the fetch errors which would fail the same way on retry,
+// like a missing repository or missing permissions
+var permanentErrorPatterns = compileErrorPatterns(
+	sshPermissionDeniedPattern,
+	repositoryNotFoundPattern,
+	notAGitRepositoryPattern,
+	invalidInfoRefsPattern,
+	httpBasicAccessDeniedPattern,
+	invalidUsernameOrPasswordPattern,
+	unauthorizedPattern,
+	forbiddenPattern,
+	unauthorizedLoginAndPasswordPattern,
+	unableToAccessPattern,
+	samlSSOEnforcedPattern,
+)
+
+// compileErrorPatterns compiles the patterns to match case-insensitively
+func compileErrorPatterns(patterns ...string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		compiled = append(compiled, regexp.MustCompile(`(?i)`+pattern))
+	}
+	return compiled
+}
+
+func matchesAny(patterns []*regexp.Regexp, msg string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableError returns false for the errors which would fail the same way on retry.
+// Errors not matching any known pattern are retried.
+func isRetryableError(err error) bool {
+	var timeoutErr commandTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return true
+	}
+
+	msg := err.Error()
+	if matchesAny(transientErrorPatterns, msg) {
+		return true
+	}
+	return !matchesAny(permanentErrorPatterns, msg)
+}
@@ -0,0 +1,210 @@
+package gitclone
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_waitBefore(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  uint
+		want   time.Duration
+	}{
+		{
+			name:   "first retry",
+			policy: RetryPolicy{Wait: 5 * time.Second},
+			retry:  1,
+			want:   5 * time.Second,
+		},
+		{
+			name:   "exponential backoff",
+			policy: RetryPolicy{Wait: 5 * time.Second},
+			retry:  4,
+			want:   40 * time.Second,
+		},
+		{
+			name:   "not capped, many retries",
+			policy: RetryPolicy{Wait: 5 * time.Second},
+			retry:  100,
+			want:   5 * time.Second << 30,
+		},
+		{
+			name:   "capped",
+			policy: RetryPolicy{Wait: 5 * time.Second, MaxWait: 30 * time.Second},
+			retry:  4,
+			want:   30 * time.Second,
+		},
+		{
+			name:   "no wait",
+			policy: RetryPolicy{},
+			retry:  3,
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.waitBefore(tt.retry))
+		})
+	}
+}
+
+func Test_configRetryPolicy(t *testing.T) {
+	zero, three, negative := 0, 3, -1
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			cfg:  Config{},
+			want: defaultRetryPolicy,
+		},
+		{
+			name: "set",
+			cfg:  Config{RetryCount: &three, RetryWait: &three, RetryMaxWait: &zero},
+			want: RetryPolicy{Retries: 3, Wait: 3 * time.Second},
+		},
+		{
+			name: "no retries",
+			cfg:  Config{RetryCount: &zero},
+			want: RetryPolicy{Retries: 0, Wait: 5 * time.Second, MaxWait: 60 * time.Second},
+		},
+		{
+			name:    "negative",
+			cfg:     Config{RetryWait: &negative},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configRetryPolicy(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_isRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "SSH permission denied",
+			err:  errors.New("git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository."),
+			want: false,
+		},
+		{
+			name: "repository not found",
+			err:  errors.New("remote: Repository not found.\nfatal: repository 'https://github.com/bitrise-io/missing.git/' not found"),
+			want: false,
+		},
+		{
+			name: "SAML SSO",
+			err:  errors.New("ERROR: The `bitrise-io' organization has enabled or enforced SAML SSO. To access\nthis repository, you must use the HTTPS remote with a personal access token"),
+			want: false,
+		},
+		{
+			name: "HTTP 403",
+			err:  errors.New("fatal: unable to access 'https://github.com/bitrise-io/git-clone.git/': The requested URL returned error: 403"),
+			want: false,
+		},
+		{
+			name: "HTTP 502",
+			err:  errors.New("fatal: unable to access 'https://github.com/bitrise-io/git-clone.git/': The requested URL returned error: 502"),
+			want: true,
+		},
+		{
+			name: "connection timed out",
+			err:  errors.New("fatal: unable to access 'https://github.com/bitrise-io/git-clone.git/': Failed to connect to github.com port 443: Connection timed out"),
+			want: true,
+		},
+		{
+			name: "early EOF",
+			err:  errors.New("fetch-pack: unexpected disconnect while reading sideband packet\nfatal: early EOF\nfatal: fetch-pack: invalid index-pack output"),
+			want: true,
+		},
+		{
+			name: "stalled",
+			err:  commandTimeoutError{stalled: true, timeout: time.Minute},
+			want: true,
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("exit status 1"),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryableError(tt.err))
+		})
+	}
+}
+
+func TestDefaultRunner_RunWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		retry        RetryPolicy
+		script       string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "succeeds",
+			retry:        RetryPolicy{Retries: 2},
+			script:       "exit 0",
+			wantAttempts: 1,
+		},
+		{
+			name:         "transient error retried",
+			retry:        RetryPolicy{Retries: 2, Wait: time.Millisecond},
+			script:       "echo 'fatal: early EOF' >&2; exit 128",
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "permanent error not retried",
+			retry:        RetryPolicy{Retries: 2, Wait: time.Millisecond},
+			script:       "echo \"fatal: repository 'https://github.com/bitrise-io/missing.git/' not found\" >&2; exit 128",
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "no retries",
+			retry:        RetryPolicy{},
+			script:       "echo 'fatal: early EOF' >&2; exit 128",
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := DefaultRunner{Retry: tt.retry}.RunWithRetry(func() *command.Model {
+				attempts++
+				return command.New("sh", "-c", tt.script)
+			})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
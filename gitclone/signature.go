@@ -0,0 +1,131 @@
+package gitclone
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	signatureOff     = "off"
+	signatureWarn    = "warn"
+	signatureRequire = "require"
+
+	signatureVerificationFailedTag = "signature_verification_failed"
+)
+
+var (
+	// [GNUPG:] GOODSIG 4AEE18F83AFDEB23 John Doe <john@example.com>
+	gpgGoodSignaturePattern = regexp.MustCompile(`(?m)^\[GNUPG:\] GOODSIG (\S+) (.+)$`)
+	// [GNUPG:] VALIDSIG 5DE3E0509C47EA3CF04A42D34AEE18F83AFDEB23 2021-03-01 ...
+	gpgValidSignaturePattern = regexp.MustCompile(`(?m)^\[GNUPG:\] VALIDSIG (\S+)`)
+	// Good "git" signature for john@example.com with ED25519 key SHA256:QOEpfOoG4g...
+	sshGoodSignaturePattern = regexp.MustCompile(`(?m)^Good "git" signature for (.+) with \S+ key (\S+)$`)
+)
+
+// SignatureInfo is the result of the signature verification of the checked out commit or tag
+type SignatureInfo struct {
+	// Object is the verified commit or tag
+	Object   string
+	Verified bool
+	// Signer is the user ID of the GPG key or the principal of the SSH key
+	Signer string
+	// Key is the fingerprint of the signing key
+	Key string
+}
+
+func validateSignatureVerification(mode, allowedSignersFile, keyringFile string) error {
+	switch mode {
+	case "", signatureOff:
+		return nil
+	case signatureWarn, signatureRequire:
+		if strings.TrimSpace(allowedSignersFile) == "" && strings.TrimSpace(keyringFile) == "" {
+			return NewParameterValidationError("signature verification can not be used: no allowed signers file or keyring file specified")
+		}
+		return nil
+	default:
+		return NewParameterValidationError(fmt.Sprintf("unknown signature verification mode: %s", mode))
+	}
+}
+
+// signedObject returns the git command verifying the checked out tag, or the specified commit (HEAD if no commit is specified).
+// On Pull Request builds the specified commit is the head of the source branch, as the merge commit is created locally.
+func signedObject(cfg Config, checkoutMethod string) (string, string) {
+	if checkoutMethod == CheckoutTagMethod.String() {
+		return "verify-tag", cfg.Tag
+	}
+	if cfg.Commit != "" {
+		return "verify-commit", cfg.Commit
+	}
+	return "verify-commit", "HEAD"
+}
+
+// verifySignature verifies the signature against the trusted keys only, the keys of the user are ignored:
+// SSH signatures against the allowed signers file, GPG signatures against a temporary home directory with the keyring imported.
+func verifySignature(gitCmd gitRunner, cfg Config, checkoutMethod string) (*SignatureInfo, error) {
+	gnupgHome, err := ioutil.TempDir("", "git-clone-gnupg")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(gnupgHome); err != nil {
+			gitCmd.log.Warnf("Failed to remove the temporary GnuPG home: %v", err)
+		}
+	}()
+
+	if cfg.SignatureKeyringFile != "" {
+		if err := gitCmd.runner.Run(command.New("gpg", "--batch", "--homedir", gnupgHome, "--import", cfg.SignatureKeyringFile)); err != nil {
+			return nil, fmt.Errorf("importing keyring (%s) failed: %v", cfg.SignatureKeyringFile, err)
+		}
+	}
+
+	allowedSignersFile := cfg.SignatureAllowedSignersFile
+	if allowedSignersFile == "" {
+		allowedSignersFile = os.DevNull
+	}
+
+	verb, object := signedObject(cfg, checkoutMethod)
+	cmd := gitCommand(gitCmd, verb, "--raw", object)
+	env := cmd.GetCmd().Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = withGitConfig(env, []gitConfigEntry{{key: "gpg.ssh.allowedSignersFile", value: allowedSignersFile}})
+	cmd.SetEnvs(append(env, "GNUPGHOME="+gnupgHome)...)
+
+	out, err := gitCmd.runner.RunForOutput(cmd)
+	signature := parseSignatureOutput(out)
+	signature.Object = object
+	signature.Verified = err == nil
+	if err != nil {
+		if strings.TrimSpace(out) == "" {
+			return signature, fmt.Errorf("%s %s failed: no signature found", verb, object)
+		}
+		return signature, fmt.Errorf("%s %s failed: %v", verb, object, err)
+	}
+
+	return signature, nil
+}
+
+// parseSignatureOutput parses the signer and key from the raw output of git verify-commit and verify-tag
+func parseSignatureOutput(output string) *SignatureInfo {
+	signature := &SignatureInfo{}
+	if match := sshGoodSignaturePattern.FindStringSubmatch(output); match != nil {
+		signature.Signer = match[1]
+		signature.Key = match[2]
+		return signature
+	}
+
+	if match := gpgGoodSignaturePattern.FindStringSubmatch(output); match != nil {
+		signature.Signer = match[2]
+		signature.Key = match[1]
+	}
+	if match := gpgValidSignaturePattern.FindStringSubmatch(output); match != nil {
+		signature.Key = match[1]
+	}
+	return signature
+}
@@ -0,0 +1,142 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateSignatureVerification(t *testing.T) {
+	tests := []struct {
+		name               string
+		mode               string
+		allowedSignersFile string
+		keyringFile        string
+		wantErr            bool
+	}{
+		{name: "off", mode: "off"},
+		{name: "not set", mode: ""},
+		{name: "warn with allowed signers", mode: "warn", allowedSignersFile: "allowed_signers"},
+		{name: "require with keyring", mode: "require", keyringFile: "keys.asc"},
+		{name: "require without trusted keys", mode: "require", wantErr: true},
+		{name: "unknown mode", mode: "strict", keyringFile: "keys.asc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSignatureVerification(tt.mode, tt.allowedSignersFile, tt.keyringFile)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_parseSignatureOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *SignatureInfo
+	}{
+		{
+			name:   "SSH signature",
+			output: `Good "git" signature for dev@example.com with ED25519 key SHA256:JZWGEm8rCJttf2Dtme+oguCUy+qL915wLJOgiOgRZEc`,
+			want:   &SignatureInfo{Signer: "dev@example.com", Key: "SHA256:JZWGEm8rCJttf2Dtme+oguCUy+qL915wLJOgiOgRZEc"},
+		},
+		{
+			name: "GPG signature",
+			output: `[GNUPG:] NEWSIG
+[GNUPG:] KEY_CONSIDERED FB2334B0950A5BBDEDD50A58EB136DB797A2256C 0
+[GNUPG:] GOODSIG EB136DB797A2256C Dev <dev@example.com>
+[GNUPG:] VALIDSIG FB2334B0950A5BBDEDD50A58EB136DB797A2256C 2021-03-01 1614556800 0 4 0 22 10 00 FB2334B0950A5BBDEDD50A58EB136DB797A2256C
+[GNUPG:] TRUST_UNDEFINED 0 pgp`,
+			want: &SignatureInfo{Signer: "Dev <dev@example.com>", Key: "FB2334B0950A5BBDEDD50A58EB136DB797A2256C"},
+		},
+		{
+			name: "GPG signature of unknown key",
+			output: `[GNUPG:] NEWSIG
+[GNUPG:] ERRSIG EB136DB797A2256C 22 10 00 1614556800 9 -
+[GNUPG:] NO_PUBKEY EB136DB797A2256C`,
+			want: &SignatureInfo{},
+		},
+		{
+			name:   "no signature",
+			output: "",
+			want:   &SignatureInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseSignatureOutput(tt.output))
+		})
+	}
+}
+
+func Test_verifySignature(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            Config
+		checkoutMethod string
+		mockRunner     *MockRunner
+		want           *SignatureInfo
+		wantErr        bool
+		wantCmds       []string
+	}{
+		{
+			name:           "Commit with allowed signers",
+			cfg:            Config{Commit: "76a934ae", SignatureAllowedSignersFile: "allowed_signers"},
+			checkoutMethod: "commit",
+			mockRunner:     givenMockRunnerSucceeds(),
+			want:           &SignatureInfo{Object: "76a934ae", Verified: true},
+			wantCmds:       []string{`git "verify-commit" "--raw" "76a934ae"`},
+		},
+		{
+			name:           "Branch",
+			cfg:            Config{Branch: "master", SignatureAllowedSignersFile: "allowed_signers"},
+			checkoutMethod: "branch",
+			mockRunner:     givenMockRunnerSucceeds(),
+			want:           &SignatureInfo{Object: "HEAD", Verified: true},
+			wantCmds:       []string{`git "verify-commit" "--raw" "HEAD"`},
+		},
+		{
+			name:           "Tag with keyring",
+			cfg:            Config{Tag: "1.0.0", SignatureKeyringFile: "keys.asc"},
+			checkoutMethod: "tag",
+			mockRunner:     givenMockRunnerSucceeds(),
+			want:           &SignatureInfo{Object: "1.0.0", Verified: true},
+			wantCmds:       []string{`git "verify-tag" "--raw" "1.0.0"`},
+		},
+		{
+			name:           "Verification fails",
+			cfg:            Config{Commit: "76a934ae", SignatureAllowedSignersFile: "allowed_signers"},
+			checkoutMethod: "commit",
+			mockRunner: new(MockRunner).
+				GivenRunForOutputFailsForCommand(`git "verify-commit" "--raw" "76a934ae"`, 1),
+			want:     &SignatureInfo{Object: "76a934ae", Verified: false},
+			wantErr:  true,
+			wantCmds: []string{`git "verify-commit" "--raw" "76a934ae"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+
+			// When
+			got, err := verifySignature(gitRunner{runner: tt.mockRunner}, tt.cfg, tt.checkoutMethod)
+
+			// Then
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.want != nil && got != nil {
+				got.Signer, got.Key = "", ""
+			}
+			assert.Equal(t, tt.want, got)
+			cmds := tt.mockRunner.Cmds()
+			assert.Equal(t, tt.wantCmds, cmds[len(cmds)-len(tt.wantCmds):])
+		})
+	}
+}
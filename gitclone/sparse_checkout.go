@@ -0,0 +1,130 @@
+package gitclone
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	sparseCone   = "cone"
+	sparseNoCone = "no_cone"
+)
+
+func validateSparseCheckoutMode(mode string) error {
+	switch mode {
+	case "", sparseCone, sparseNoCone:
+		return nil
+	default:
+		return NewParameterValidationError(fmt.Sprintf("unknown sparse-checkout mode: %s", mode))
+	}
+}
+
+func isSparseCheckout(cfg Config) bool {
+	return len(cfg.SparseDirectories) != 0 || cfg.SparseSpecFile != ""
+}
+
+// coneSparseDirectories returns the sparse-checkout directories, nil if the sparse-checkout patterns are not directories (non-cone mode)
+func coneSparseDirectories(cfg Config) []string {
+	if cfg.SparseCheckoutMode == sparseNoCone {
+		return nil
+	}
+	return cfg.SparseDirectories
+}
+
+func sparseCheckoutSetCommand(gitCmd gitRunner, mode string, patterns []string) *command.Model {
+	if mode == sparseNoCone {
+		return gitCmd.SparseCheckoutSet(append([]string{"--no-cone"}, patterns...)...)
+	}
+	return gitCmd.SparseCheckoutSet(patterns...)
+}
+
+func setupSparseCheckout(gitCmd gitRunner, cfg Config) error {
+	if !isSparseCheckout(cfg) {
+		return nil
+	}
+
+	initCommand := gitCmd.SparseCheckoutInit(true)
+	if cfg.SparseCheckoutMode == sparseNoCone {
+		// Git defaults to cone mode since 2.37
+		initCommand = gitCommand(gitCmd, "sparse-checkout", "init", "--no-cone")
+	}
+	if err := gitCmd.runner.Run(initCommand); err != nil {
+		return newStepError(
+			sparseCheckoutFailedTag,
+			fmt.Errorf("initializing sparse-checkout config failed: %v", err),
+			"Initializing sparse-checkout config has failed",
+		)
+	}
+
+	if len(cfg.SparseDirectories) == 0 {
+		// Only the files of the root directory are checked out until the sparse-checkout specification file is read
+		return nil
+	}
+
+	sparseSetCommand := sparseCheckoutSetCommand(gitCmd, cfg.SparseCheckoutMode, cfg.SparseDirectories)
+	if err := gitCmd.runner.Run(sparseSetCommand); err != nil {
+		return newStepError(
+			sparseCheckoutFailedTag,
+			fmt.Errorf("updating sparse-checkout config failed: %v", err),
+			"Updating sparse-checkout config has failed",
+		)
+	}
+
+	return nil
+}
+
+// applySparseSpecFile extends the sparse-checkout patterns by the ones in the specification file of the checked out commit,
+// and returns the effective patterns
+func applySparseSpecFile(gitCmd gitRunner, cfg Config) ([]string, error) {
+	specFile := strings.TrimPrefix(path.Clean("/"+strings.TrimSpace(cfg.SparseSpecFile)), "/")
+	out, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "show", "HEAD:"+specFile))
+	if err != nil {
+		return nil, newStepError(
+			sparseCheckoutFailedTag,
+			fmt.Errorf("reading sparse-checkout specification (%s) failed: %v", specFile, err),
+			"Reading sparse-checkout specification has failed",
+		)
+	}
+
+	specPatterns := parseSparseSpec(out)
+	if len(specPatterns) == 0 {
+		return nil, newStepError(
+			sparseCheckoutFailedTag,
+			fmt.Errorf("sparse-checkout specification (%s) has no patterns", specFile),
+			"Reading sparse-checkout specification has failed",
+		)
+	}
+
+	gitCmd.log.Infof("Sparse-checkout patterns of %s:", specFile)
+	for _, pattern := range specPatterns {
+		gitCmd.log.Printf("- %s", pattern)
+	}
+
+	patterns := append(append([]string{}, cfg.SparseDirectories...), specPatterns...)
+	if err := gitCmd.runner.Run(sparseCheckoutSetCommand(gitCmd, cfg.SparseCheckoutMode, patterns)); err != nil {
+		return nil, newStepError(
+			sparseCheckoutFailedTag,
+			fmt.Errorf("updating sparse-checkout config failed: %v", err),
+			"Updating sparse-checkout config has failed",
+		)
+	}
+
+	return patterns, nil
+}
+
+// parseSparseSpec returns the patterns of the sparse-checkout specification, one pattern per line.
+// Empty lines and lines starting with # are ignored.
+func parseSparseSpec(spec string) []string {
+	var patterns []string
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
@@ -0,0 +1,88 @@
+package gitclone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSparseSpec(t *testing.T) {
+	spec := `# iOS app and its shared modules
+ios
+
+  shared/ui  
+# shared/android
+`
+
+	assert.Equal(t, []string{"ios", "shared/ui"}, parseSparseSpec(spec))
+	assert.Nil(t, parseSparseSpec("# only comments"))
+}
+
+func Test_applySparseSpecFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Config
+		spec         string
+		wantErr      bool
+		wantPatterns []string
+		wantCmds     []string
+	}{
+		{
+			name:         "Directories of the specification file",
+			cfg:          Config{SparseSpecFile: "./.bitrise/sparse-ios"},
+			spec:         "ios\nshared",
+			wantPatterns: []string{"ios", "shared"},
+			wantCmds: []string{
+				`git "show" "HEAD:.bitrise/sparse-ios"`,
+				`git "sparse-checkout" "set" "ios" "shared"`,
+			},
+		},
+		{
+			name:         "Non-cone patterns extending the input",
+			cfg:          Config{SparseSpecFile: "/.bitrise/sparse-ios", SparseDirectories: []string{"/*", "!/*/"}, SparseCheckoutMode: "no_cone"},
+			spec:         "/ios/\n!/ios/**/Tests/",
+			wantPatterns: []string{"/*", "!/*/", "/ios/", "!/ios/**/Tests/"},
+			wantCmds: []string{
+				`git "show" "HEAD:.bitrise/sparse-ios"`,
+				`git "sparse-checkout" "set" "--no-cone" "/*" "!/*/" "/ios/" "!/ios/**/Tests/"`,
+			},
+		},
+		{
+			name:    "Empty specification file",
+			cfg:     Config{SparseSpecFile: ".bitrise/sparse-ios"},
+			spec:    "# no patterns",
+			wantErr: true,
+			wantCmds: []string{
+				`git "show" "HEAD:.bitrise/sparse-ios"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			mockRunner := new(MockRunner).
+				GivenRunForOutputSucceedsForCommand(`git "show" "HEAD:.bitrise/sparse-ios"`, tt.spec).
+				GivenRunSucceeds()
+
+			// When
+			patterns, err := applySparseSpecFile(gitRunner{runner: mockRunner}, tt.cfg)
+
+			// Then
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantPatterns, patterns)
+			assert.Equal(t, tt.wantCmds, mockRunner.Cmds())
+		})
+	}
+}
+
+func Test_applySparseSpecFile_missingFile(t *testing.T) {
+	// Given
+	mockRunner := new(MockRunner).
+		GivenRunForOutputFailsForCommand(`git "show" "HEAD:.bitrise/sparse-ios"`, 1)
+
+	// When
+	_, err := applySparseSpecFile(gitRunner{runner: mockRunner}, Config{SparseSpecFile: ".bitrise/sparse-ios"})
+
+	// Then
+	assert.EqualError(t, err, "reading sparse-checkout specification (.bitrise/sparse-ios) failed: dummy_cmd_error")
+}
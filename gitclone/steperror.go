@@ -1,6 +1,7 @@
 package gitclone
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/bitrise-io/bitrise-init/errormapper"
@@ -8,7 +9,9 @@ import (
 )
 
 const (
-	branchRecKey = "BranchRecommendation"
+	branchRecKey           = "BranchRecommendation"
+	urlRewritesRecKey      = "URLRewrites"
+	failedSubmodulesRecKey = "FailedSubmodules"
 )
 
 func mapDetailedErrorRecommendation(tag, errMsg string) step.Recommendation {
@@ -27,7 +30,29 @@ func mapDetailedErrorRecommendation(tag, errMsg string) step.Recommendation {
 	return nil
 }
 
+// redactedError masks the credentials and the secrets in the message of the wrapped error
+type redactedError struct {
+	err     error
+	secrets secrets
+}
+
+// Error ...
+func (e redactedError) Error() string {
+	return e.secrets.redact(e.err.Error())
+}
+
+// Unwrap ...
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
 func newStepError(tag string, err error, shortMsg string) error {
+	// The error may contain a repository URL with credentials or the output of a git command
+	if msg := err.Error(); Redact(msg) != msg {
+		err = redactedError{err: err}
+	}
+	shortMsg = Redact(shortMsg)
+
 	recommendations := mapDetailedErrorRecommendation(tag, err.Error())
 	if recommendations != nil {
 		return step.NewErrorWithRecommendations("git-clone", tag, err, shortMsg, recommendations)
@@ -54,6 +79,40 @@ func newStepErrorWithBranchRecommendations(tag string, err error, shortMsg, curr
 	return newErr
 }
 
+// withURLRewriteRecommendations extends the step error's recommendations with the effective rewritten URLs
+func withURLRewriteRecommendations(err error, rewrites []string) error {
+	if len(rewrites) == 0 {
+		return err
+	}
+
+	var stepErr *step.Error
+	if errors.As(err, &stepErr) {
+		if stepErr.Recommendations == nil {
+			stepErr.Recommendations = step.Recommendation{}
+		}
+		stepErr.Recommendations[urlRewritesRecKey] = rewrites
+	}
+
+	return err
+}
+
+// withFailedSubmoduleRecommendations extends the step error's recommendations with the paths of the failed submodules
+func withFailedSubmoduleRecommendations(err error, paths []string) error {
+	if len(paths) == 0 {
+		return err
+	}
+
+	var stepErr *step.Error
+	if errors.As(err, &stepErr) {
+		if stepErr.Recommendations == nil {
+			stepErr.Recommendations = step.Recommendation{}
+		}
+		stepErr.Recommendations[failedSubmodulesRecKey] = paths
+	}
+
+	return err
+}
+
 func newUpdateSubmoduleFailedErrorMatcher() *errormapper.PatternErrorMatcher {
 	return &errormapper.PatternErrorMatcher{
 		DefaultBuilder: newUpdateSubmoduleFailedGenericDetailedError,
@@ -96,30 +155,48 @@ func newCheckoutFailedPatternErrorMatcher() *errormapper.PatternErrorMatcher {
 	}
 }
 
+// Error patterns of a failed fetch, also used to classify the retryable errors
+const (
+	sshPermissionDeniedPattern          = `Permission denied \((.+)\)`
+	repositoryNotFoundPattern           = `fatal: repository '(.+)' not found`
+	notAGitRepositoryPattern            = `fatal: '(.+)' does not appear to be a git repository`
+	invalidInfoRefsPattern              = `fatal: (.+)/info/refs not valid: is this a git repository?`
+	httpBasicAccessDeniedPattern        = `remote: HTTP Basic: Access denied[\n]*fatal: Authentication failed for '(.+)'`
+	invalidUsernameOrPasswordPattern    = `remote: Invalid username or password\(\.\)[\n]*fatal: Authentication failed for '(.+)'`
+	unauthorizedPattern                 = `Unauthorized`
+	forbiddenPattern                    = `Forbidden`
+	unauthorizedLoginAndPasswordPattern = `remote: Unauthorized LoginAndPassword`
+	// `fatal: unable to access '(.+)': Failed to connect to .+ port \d+: Connection timed out
+	// `fatal: unable to access '(.+)': The requested URL returned error: 400`
+	// `fatal: unable to access '(.+)': The requested URL returned error: 403`
+	unableToAccessPattern = `fatal: unable to access '(.+)': (Failed|The requested URL returned error: \d+)`
+	// `ssh: connect to host (.+) port \d+: Connection timed out`
+	// `ssh: connect to host (.+) port \d+: Connection refused`
+	// `ssh: connect to host (.+) port \d+: Network is unreachable`
+	sshConnectPattern             = `ssh: connect to host (.+) port \d+:`
+	sshCouldNotResolveHostPattern = `ssh: Could not resolve hostname (.+): Name or service not known`
+	couldNotResolveHostPattern    = `fatal: unable to access '.+': Could not resolve host: (\S+)`
+	samlSSOEnforcedPattern        = `ERROR: The \x60(.+)' organization has enabled or enforced SAML SSO`
+)
+
 func newFetchFailedPatternErrorMatcher() *errormapper.PatternErrorMatcher {
 	return &errormapper.PatternErrorMatcher{
 		DefaultBuilder: newFetchFailedGenericDetailedError,
 		PatternToBuilder: errormapper.PatternToDetailedErrorBuilder{
-			`Permission denied \((.+)\)`:                                                             newFetchFailedSSHAccessErrorDetailedError,
-			`fatal: repository '(.+)' not found`:                                                     newFetchFailedCouldNotFindGitRepoDetailedError,
-			`fatal: '(.+)' does not appear to be a git repository`:                                   newFetchFailedCouldNotFindGitRepoDetailedError,
-			`fatal: (.+)/info/refs not valid: is this a git repository?`:                             newFetchFailedCouldNotFindGitRepoDetailedError,
-			`remote: HTTP Basic: Access denied[\n]*fatal: Authentication failed for '(.+)'`:          newFetchFailedHTTPAccessErrorDetailedError,
-			`remote: Invalid username or password\(\.\)[\n]*fatal: Authentication failed for '(.+)'`: newFetchFailedHTTPAccessErrorDetailedError,
-			`Unauthorized`:                          newFetchFailedHTTPAccessErrorDetailedError,
-			`Forbidden`:                             newFetchFailedHTTPAccessErrorDetailedError,
-			`remote: Unauthorized LoginAndPassword`: newFetchFailedHTTPAccessErrorDetailedError,
-			// `fatal: unable to access '(.+)': Failed to connect to .+ port \d+: Connection timed out
-			// `fatal: unable to access '(.+)': The requested URL returned error: 400`
-			// `fatal: unable to access '(.+)': The requested URL returned error: 403`
-			`fatal: unable to access '(.+)': (Failed|The requested URL returned error: \d+)`: newFetchFailedHTTPAccessErrorDetailedError,
-			// `ssh: connect to host (.+) port \d+: Connection timed out`
-			// `ssh: connect to host (.+) port \d+: Connection refused`
-			// `ssh: connect to host (.+) port \d+: Network is unreachable`
-			`ssh: connect to host (.+) port \d+:`:                                newFetchFailedCouldConnectErrorDetailedError,
-			`ssh: Could not resolve hostname (.+): Name or service not known`:    newFetchFailedCouldConnectErrorDetailedError,
-			`fatal: unable to access '.+': Could not resolve host: (\S+)`:        newFetchFailedCouldConnectErrorDetailedError,
-			`ERROR: The \x60(.+)' organization has enabled or enforced SAML SSO`: newFetchFailedSamlSSOEnforcedDetailedError,
+			sshPermissionDeniedPattern:          newFetchFailedSSHAccessErrorDetailedError,
+			repositoryNotFoundPattern:           newFetchFailedCouldNotFindGitRepoDetailedError,
+			notAGitRepositoryPattern:            newFetchFailedCouldNotFindGitRepoDetailedError,
+			invalidInfoRefsPattern:              newFetchFailedCouldNotFindGitRepoDetailedError,
+			httpBasicAccessDeniedPattern:        newFetchFailedHTTPAccessErrorDetailedError,
+			invalidUsernameOrPasswordPattern:    newFetchFailedHTTPAccessErrorDetailedError,
+			unauthorizedPattern:                 newFetchFailedHTTPAccessErrorDetailedError,
+			forbiddenPattern:                    newFetchFailedHTTPAccessErrorDetailedError,
+			unauthorizedLoginAndPasswordPattern: newFetchFailedHTTPAccessErrorDetailedError,
+			unableToAccessPattern:               newFetchFailedHTTPAccessErrorDetailedError,
+			sshConnectPattern:                   newFetchFailedCouldConnectErrorDetailedError,
+			sshCouldNotResolveHostPattern:       newFetchFailedCouldConnectErrorDetailedError,
+			couldNotResolveHostPattern:          newFetchFailedCouldConnectErrorDetailedError,
+			samlSSOEnforcedPattern:              newFetchFailedSamlSSOEnforcedDetailedError,
 		},
 	}
 }
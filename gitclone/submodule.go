@@ -0,0 +1,362 @@
+package gitclone
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	defaultSubmoduleJobs = 10
+
+	submoduleRecursive = "recursive"
+	submoduleTopLevel  = "top_level"
+
+	submodulePinned = "pinned"
+	submoduleRemote = "remote"
+)
+
+// failedSubmodulePattern matches the submodule path in the error messages of git submodule update, for example:
+// fatal: clone of 'git@github.com:bitrise-io/lib.git' into submodule path '/bitrise/src/lib' failed
+// Failed to clone 'lib' a second time, aborting
+// fatal: Unable to fetch in submodule path 'lib'
+// fatal: Unable to checkout '76a934ae' in submodule path 'lib'
+// fatal: Failed to recurse into submodule path 'lib'
+var failedSubmodulePattern = regexp.MustCompile(`(?:submodule path|Failed to clone) '([^']+)'`)
+
+// submoduleUpdate builds the git submodule update commands with the same options
+type submoduleUpdate struct {
+	gitCmd gitRunner
+	args   []string
+}
+
+func newSubmoduleUpdate(gitCmd gitRunner, limitDepth, recursive bool, opts ...string) submoduleUpdate {
+	var args []string
+	for _, arg := range gitCmd.SubmoduleUpdate(limitDepth, opts...).GetCmd().Args[1:] {
+		if arg == "--recursive" && !recursive {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return submoduleUpdate{gitCmd: gitCmd, args: args}
+}
+
+// command updates the submodules at the given paths, or every submodule if no path is given
+func (u submoduleUpdate) command(paths ...string) *command.Model {
+	args := append([]string{}, u.args...)
+	if len(paths) != 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	return gitCommand(u.gitCmd, args...)
+}
+
+func validateSubmoduleUpdate(recursion, mode string) error {
+	switch recursion {
+	case "", submoduleRecursive, submoduleTopLevel:
+	default:
+		return NewParameterValidationError(fmt.Sprintf("unknown submodule recursion: %s", recursion))
+	}
+
+	switch mode {
+	case "", submodulePinned, submoduleRemote:
+	default:
+		return NewParameterValidationError(fmt.Sprintf("unknown submodule update mode: %s", mode))
+	}
+	return nil
+}
+
+func updateSubmodules(gitCmd gitRunner, cfg Config) error {
+	if err := runSubmoduleUpdate(gitCmd, cfg); err != nil {
+		return err
+	}
+
+	if cfg.SubmoduleUpdateMode == submoduleRemote {
+		logMovedSubmodules(gitCmd)
+	}
+	return nil
+}
+
+func runSubmoduleUpdate(gitCmd gitRunner, cfg Config) error {
+	filter, err := parseCloneFilter(cfg.CloneFilter)
+	if err != nil {
+		return err
+	}
+
+	jobs := cfg.SubmoduleJobs
+	if jobs <= 0 {
+		jobs = defaultSubmoduleJobs
+	}
+	opts := []string{fmt.Sprintf("--jobs=%d", jobs)}
+	if isExplicitCloneFilter(filter) {
+		opts = append(opts, "--filter="+filter)
+	}
+	opts = append(opts, "--progress")
+	if cfg.SubmoduleUpdateMode == submoduleRemote {
+		// Checks out the tip of the branch tracked by the submodule instead of the commit recorded in the repository
+		opts = append(opts, "--remote")
+	}
+	update := newSubmoduleUpdate(gitCmd, cfg.LimitSubmoduleUpdateDepth, cfg.SubmoduleRecursion != submoduleTopLevel, opts...)
+
+	selection := submoduleFilter{include: cfg.SubmodulePaths, exclude: cfg.SubmoduleExclude, sparseDirectories: coneSparseDirectories(cfg)}
+	var paths, selected []string
+	if !selection.isEmpty() {
+		paths = submodulePaths(gitCmd)
+	}
+	if len(paths) != 0 {
+		gitCmd.log.Infof("Selecting submodules:")
+		for _, pth := range paths {
+			if ok, reason := selection.selected(pth); ok {
+				gitCmd.log.Printf("- %s", pth)
+				selected = append(selected, pth)
+			} else {
+				gitCmd.log.Printf("- %s: skipped, %s", pth, reason)
+			}
+		}
+		if len(selected) == 0 {
+			gitCmd.log.Warnf("No submodule selected, skipping submodule update")
+			return nil
+		}
+		// The nested submodules of the selected submodules are updated without filtering
+	}
+
+	err = gitCmd.runner.Run(update.command(selected...))
+	if err == nil {
+		return nil
+	}
+
+	var timeoutErr commandTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return newStepError(
+			timeoutErr.tag("update_submodule"),
+			fmt.Errorf("submodule update: %v", err),
+			"Updating submodules has timed out",
+		)
+	}
+
+	if paths == nil {
+		paths = submodulePaths(gitCmd)
+	}
+	failed := failedSubmodulePaths(err.Error(), repositoryDir(gitCmd), paths)
+	if len(failed) == 0 {
+		return newStepError(
+			updateSubmodelFailedTag,
+			fmt.Errorf("submodule update: %v", err),
+			"Updating submodules has failed",
+		)
+	}
+
+	// Retry only the failed submodules, then update the rest which may have been skipped by the failure
+	gitCmd.log.Warnf("Updating submodules failed (%s), retrying the failed submodules one by one", strings.Join(failed, ", "))
+	for _, pth := range failed {
+		pth := pth
+		if err := gitCmd.runner.RunWithRetry(func() *command.Model {
+			return update.command(pth)
+		}); err != nil {
+			return withFailedSubmoduleRecommendations(newStepError(
+				updateSubmodelFailedTag,
+				fmt.Errorf("submodule update (%s): %v", pth, err),
+				"Updating submodules has failed",
+			), []string{pth})
+		}
+	}
+
+	if err := gitCmd.runner.Run(update.command(selected...)); err != nil {
+		return withFailedSubmoduleRecommendations(newStepError(
+			updateSubmodelFailedTag,
+			fmt.Errorf("submodule update: %v", err),
+			"Updating submodules has failed",
+		), failedSubmodulePaths(err.Error(), repositoryDir(gitCmd), paths))
+	}
+
+	return nil
+}
+
+// logMovedSubmodules logs the submodules checked out at a different commit than the one recorded in the repository
+func logMovedSubmodules(gitCmd gitRunner) {
+	statuses, recorded, err := submoduleCommits(gitCmd)
+	if err != nil {
+		gitCmd.log.Warnf("Failed to list the moved submodules: %v", err)
+		return
+	}
+
+	var moved []string
+	for _, status := range statuses {
+		if status.initialized && recorded[status.path] != status.sha {
+			moved = append(moved, fmt.Sprintf("- %s: %s => %s", status.path, recorded[status.path], status.sha))
+		}
+	}
+
+	if len(moved) == 0 {
+		gitCmd.log.Donef("The submodules are at the recorded commits, the tracked branches have not moved")
+		return
+	}
+	gitCmd.log.Infof("Submodules moved to the tip of the tracked branch:")
+	for _, line := range moved {
+		gitCmd.log.Printf("%s", line)
+	}
+}
+
+// repositoryDir returns the absolute path of the working directory of the git commands
+func repositoryDir(gitCmd gitRunner) string {
+	dir, err := filepath.Abs(gitCommand(gitCmd).GetCmd().Dir)
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// failedSubmodulePaths returns the paths of the failed submodules from the output of git submodule update.
+// The failures of the nested submodules are attributed to the submodule of the repository containing them.
+func failedSubmodulePaths(output, repositoryDir string, submodulePaths []string) []string {
+	var failed []string
+	seen := map[string]bool{}
+	for _, match := range failedSubmodulePattern.FindAllStringSubmatch(output, -1) {
+		pth := match[1]
+		if filepath.IsAbs(pth) && repositoryDir != "" {
+			if rel, err := filepath.Rel(repositoryDir, pth); err == nil {
+				pth = rel
+			}
+		}
+		pth = cleanSubmodulePath(pth)
+
+		for _, submodulePath := range submodulePaths {
+			if isInAnyDirectory([]string{submodulePath}, pth) {
+				pth = cleanSubmodulePath(submodulePath)
+				break
+			}
+		}
+
+		if !seen[pth] {
+			seen[pth] = true
+			failed = append(failed, pth)
+		}
+	}
+	return failed
+}
+
+// submoduleValue is a config value of a submodule declared in .gitmodules
+type submoduleValue struct {
+	name  string
+	value string
+}
+
+// submoduleConfig returns the given config key (for example path or url) of the submodules declared in .gitmodules, in the order of declaration
+func submoduleConfig(gitCmd gitRunner, key string) []submoduleValue {
+	// Fails if there is no .gitmodules file
+	out, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.`+key+`$`))
+	if err != nil {
+		return nil
+	}
+
+	var values []submoduleValue
+	for _, line := range strings.Split(out, "\n") {
+		// Both the name and the value may contain spaces: submodule.libs/my lib.path libs/my lib
+		fields := strings.SplitN(strings.TrimPrefix(line, "submodule."), "."+key+" ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		values = append(values, submoduleValue{name: fields[0], value: fields[1]})
+	}
+	return values
+}
+
+// submodulePaths returns the paths of the submodules declared in .gitmodules, in the order of declaration
+func submodulePaths(gitCmd gitRunner) []string {
+	var paths []string
+	for _, path := range submoduleConfig(gitCmd, "path") {
+		paths = append(paths, path.value)
+	}
+	return paths
+}
+
+// submoduleFilter selects the submodules to update by their path
+type submoduleFilter struct {
+	// include patterns, every submodule is included if empty
+	include []string
+	exclude []string
+	// sparseDirectories are the cone mode sparse-checkout directories, the submodules outside of them are excluded
+	sparseDirectories []string
+}
+
+func (f submoduleFilter) isEmpty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0 && len(f.sparseDirectories) == 0
+}
+
+// selected returns if the submodule is selected, or the reason it is skipped
+func (f submoduleFilter) selected(submodulePath string) (bool, string) {
+	if len(f.include) != 0 && !matchesAnyPathPattern(f.include, submodulePath) {
+		return false, "not matching submodule_paths"
+	}
+	if matchesAnyPathPattern(f.exclude, submodulePath) {
+		return false, "matching submodule_exclude"
+	}
+	if len(f.sparseDirectories) != 0 && !isInAnyDirectory(f.sparseDirectories, submodulePath) {
+		return false, "outside of sparse_directories"
+	}
+	return true, ""
+}
+
+func matchesAnyPathPattern(patterns []string, pth string) bool {
+	for _, pattern := range patterns {
+		if matchPathPattern(pattern, pth) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern matches the path or any of its parent directories against the glob pattern.
+// The path.Match syntax is extended by `**`, which matches any number of directories.
+func matchPathPattern(pattern, pth string) bool {
+	pattern = strings.Trim(cleanSubmodulePath(pattern), "/")
+	segments := strings.Split(cleanSubmodulePath(pth), "/")
+	for i := len(segments); i > 0; i-- {
+		if matchSegments(strings.Split(pattern, "/"), segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func isInAnyDirectory(dirs []string, pth string) bool {
+	pth = cleanSubmodulePath(pth)
+	for _, dir := range dirs {
+		dir = strings.Trim(cleanSubmodulePath(dir), "/")
+		if pth == dir || strings.HasPrefix(pth, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanSubmodulePath(pth string) string {
+	return strings.TrimPrefix(path.Clean(strings.ReplaceAll(strings.TrimSpace(pth), `\`, "/")), "./")
+}
@@ -0,0 +1,140 @@
+package gitclone
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	submodulesFileName = "git_clone_submodules.json"
+	submodulesEnv      = "GIT_CLONE_SUBMODULES"
+	submodulesPathEnv  = "GIT_CLONE_SUBMODULES_PATH"
+)
+
+// SubmoduleInfo is the state of a submodule after the submodule update, nested submodules included
+type SubmoduleInfo struct {
+	Path string `json:"path"`
+	// URL is the remote of the submodule, credentials are redacted
+	URL string `json:"url,omitempty"`
+	// ExpectedSHA is the commit recorded in the containing repository
+	ExpectedSHA string `json:"expected_sha"`
+	// SHA is the checked out commit, empty if the submodule is not initialized
+	SHA string `json:"sha"`
+	// Dirty is true if the submodule has local modifications
+	Dirty bool `json:"dirty"`
+	// Detached is true if no branch is checked out in the submodule
+	Detached bool `json:"detached"`
+}
+
+type submoduleStatus struct {
+	path        string
+	sha         string
+	initialized bool
+}
+
+// parseSubmoduleStatus parses the output of `git submodule status`, lines are formatted as:
+// [ +-U]<sha> <path>[ (<describe>)]
+func parseSubmoduleStatus(output string) []submoduleStatus {
+	var submodules []submoduleStatus
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		// The leading space of the first line is trimmed from the command output
+		prefix := line[0]
+		if strings.ContainsRune(" +-U", rune(prefix)) {
+			line = line[1:]
+		}
+
+		// The path may contain spaces, the describe output of uninitialized submodules is missing
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		path := fields[1]
+		if i := strings.LastIndex(path, " ("); i >= 0 && strings.HasSuffix(path, ")") {
+			path = path[:i]
+		}
+
+		submodules = append(submodules, submoduleStatus{
+			path:        path,
+			sha:         fields[0],
+			initialized: prefix != '-',
+		})
+	}
+	return submodules
+}
+
+// submoduleCommits returns the status of the submodules, and the commits recorded in the containing repositories by submodule path
+func submoduleCommits(gitCmd gitRunner) ([]submoduleStatus, map[string]string, error) {
+	out, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "submodule", "status", "--recursive"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("submodule status failed: %v", err)
+	}
+	statuses := parseSubmoduleStatus(out)
+
+	out, err = gitCmd.runner.RunForOutput(gitCommand(gitCmd, "submodule", "status", "--cached", "--recursive"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("submodule status failed: %v", err)
+	}
+	recorded := map[string]string{}
+	for _, status := range parseSubmoduleStatus(out) {
+		recorded[status.path] = status.sha
+	}
+
+	return statuses, recorded, nil
+}
+
+// collectSubmoduleState compares the checked out commits of the submodules to the commits recorded in the containing repositories
+func collectSubmoduleState(gitCmd gitRunner) ([]SubmoduleInfo, error) {
+	statuses, expected, err := submoduleCommits(gitCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules := []SubmoduleInfo{}
+	for _, status := range statuses {
+		submodule := SubmoduleInfo{
+			Path:        status.path,
+			ExpectedSHA: expected[status.path],
+		}
+		if !status.initialized {
+			submodules = append(submodules, submodule)
+			continue
+		}
+		submodule.SHA = status.sha
+
+		// Fails if the submodule has no origin remote
+		if url, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "-C", status.path, "config", "--get", "remote.origin.url")); err == nil {
+			submodule.URL = Redact(url)
+		}
+
+		out, err := gitCmd.runner.RunForOutput(gitCommand(gitCmd, "-C", status.path, "status", "--porcelain"))
+		if err != nil {
+			return nil, fmt.Errorf("status of submodule (%s) failed: %v", status.path, err)
+		}
+		submodule.Dirty = strings.TrimSpace(out) != ""
+
+		// Fails if HEAD is detached
+		_, err = gitCmd.runner.RunForOutput(gitCommand(gitCmd, "-C", status.path, "symbolic-ref", "--quiet", "HEAD"))
+		submodule.Detached = err != nil
+
+		submodules = append(submodules, submodule)
+	}
+	return submodules, nil
+}
+
+// writeSubmoduleState writes the submodule state to a temporary directory, and returns its path
+func writeSubmoduleState(submodules []SubmoduleInfo) (string, error) {
+	return writeTempJSONFile("git-clone-submodules", submodulesFileName, submodules)
+}
+
+func submoduleStateJSON(submodules []SubmoduleInfo) string {
+	b, err := json.Marshal(submodules)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,199 @@
+package gitclone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-init/step"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_matchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "android/ui", path: "android/ui", want: true},
+		{pattern: "android", path: "android/ui", want: true},
+		{pattern: "android/", path: "android/ui", want: true},
+		{pattern: "./android/*", path: "android/ui", want: true},
+		{pattern: "android/*", path: "android/ui/nested", want: true},
+		{pattern: "android", path: "android-ui", want: false},
+		{pattern: "*-ui", path: "android-ui", want: true},
+		{pattern: "**/analytics", path: "ios/vendor/analytics", want: true},
+		{pattern: "**/analytics", path: "analytics", want: true},
+		{pattern: "ios/**/analytics", path: "ios/analytics", want: true},
+		{pattern: "ios/**/analytics", path: "android/vendor/analytics", want: false},
+		{pattern: "vendor", path: "ios/vendor/analytics", want: false},
+		{pattern: "[", path: "ios", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchPathPattern(tt.pattern, tt.path))
+		})
+	}
+}
+
+func Test_submoduleFilter_selected(t *testing.T) {
+	filter := submoduleFilter{
+		include:           []string{"ios/**", "shared"},
+		exclude:           []string{"ios/vendor"},
+		sparseDirectories: []string{"ios", "shared/"},
+	}
+
+	tests := []struct {
+		path       string
+		want       bool
+		wantReason string
+	}{
+		{path: "ios/ui", want: true},
+		{path: "shared", want: true},
+		{path: "android/ui", want: false, wantReason: "not matching submodule_paths"},
+		{path: "ios/vendor/analytics", want: false, wantReason: "matching submodule_exclude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, reason := filter.selected(tt.path)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+
+	got, reason := submoduleFilter{sparseDirectories: []string{"ios"}}.selected("android/ui")
+	assert.False(t, got)
+	assert.Equal(t, "outside of sparse_directories", reason)
+}
+
+func Test_failedSubmodulePaths(t *testing.T) {
+	submodulePaths := []string{"ios/ui", "shared"}
+
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name:   "Clone failure with absolute path",
+			output: "fatal: clone of 'git@github.com:bitrise-io/ui.git' into submodule path '/bitrise/src/ios/ui' failed\nFailed to clone 'ios/ui' a second time, aborting",
+			want:   []string{"ios/ui"},
+		},
+		{
+			name:   "Checkout failure",
+			output: "fatal: Unable to checkout '76a934ae' in submodule path 'shared'",
+			want:   []string{"shared"},
+		},
+		{
+			name:   "Nested submodule failure",
+			output: "fatal: Unable to fetch in submodule path 'ios/ui/vendor/analytics'\nfatal: Failed to recurse into submodule path 'ios/ui'",
+			want:   []string{"ios/ui"},
+		},
+		{
+			name:   "No submodule path",
+			output: "fatal: not a git repository",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, failedSubmodulePaths(tt.output, "/bitrise/src", submodulePaths))
+		})
+	}
+}
+
+func Test_updateSubmodules_retriesFailedSubmodules(t *testing.T) {
+	updateCmd := `git "submodule" "update" "--init" "--recursive" "--jobs=10" "--progress"`
+	updateErr := errors.New("fatal: Unable to fetch in submodule path 'shared'")
+	gitmodules := "submodule.ios-ui.path ios/ui\nsubmodule.shared.path shared"
+
+	tests := []struct {
+		name           string
+		retrySucceeds  bool
+		wantErr        bool
+		wantCmds       []string
+		wantRecommends []string
+	}{
+		{
+			name:          "Failed submodule retried",
+			retrySucceeds: true,
+			wantCmds: []string{
+				updateCmd,
+				`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`,
+				updateCmd + ` "--" "shared"`,
+				updateCmd,
+			},
+		},
+		{
+			name:    "Failed submodule retry fails",
+			wantErr: true,
+			wantCmds: []string{
+				updateCmd,
+				`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`,
+				updateCmd + ` "--" "shared"`,
+			},
+			wantRecommends: []string{"shared"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			mockRunner := new(MockRunner).
+				GivenRunFailsForCommandWithError(updateCmd, updateErr, 1).
+				GivenRunForOutputSucceedsForCommand(`git "config" "--file" ".gitmodules" "--get-regexp" "^submodule\\..*\\.path$"`, gitmodules)
+			if tt.retrySucceeds {
+				mockRunner.GivenRunWithRetrySucceeds()
+			} else {
+				mockRunner.GivenRunWithRetryFailsAfter(0)
+			}
+			mockRunner.GivenRunSucceeds()
+
+			// When
+			err := updateSubmodules(gitRunner{runner: mockRunner}, Config{})
+
+			// Then
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCmds, mockRunner.Cmds())
+			if tt.wantRecommends != nil {
+				var stepErr *step.Error
+				assert.True(t, errors.As(err, &stepErr))
+				assert.Equal(t, updateSubmodelFailedTag, stepErr.Tag)
+				assert.Equal(t, tt.wantRecommends, stepErr.Recommendations[failedSubmodulesRecKey])
+			}
+		})
+	}
+}
+
+func Test_validateSubmoduleUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		recursion string
+		mode      string
+		wantErr   bool
+	}{
+		{name: "Defaults"},
+		{name: "Top-level remote update", recursion: "top_level", mode: "remote"},
+		{name: "Recursive pinned update", recursion: "recursive", mode: "pinned"},
+		{name: "Unknown recursion", recursion: "nested", wantErr: true},
+		{name: "Unknown mode", mode: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSubmoduleUpdate(tt.recursion, tt.mode)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_submodulePaths(t *testing.T) {
+	// Given
+	mockRunner := new(MockRunner)
+	mockRunner.On("RunForOutput", mock.Anything).
+		Return("submodule.libs/ui.path libs/ui\nsubmodule.libs/my lib.path libs/my lib", nil)
+
+	// When
+	paths := submodulePaths(gitRunner{runner: mockRunner})
+
+	// Then
+	assert.Equal(t, []string{"libs/ui", "libs/my lib"}, paths)
+}
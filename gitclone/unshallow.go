@@ -1,11 +1,11 @@
 package gitclone
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/bitrise-io/go-utils/command"
-	"github.com/bitrise-io/go-utils/command/git"
-	"github.com/bitrise-io/go-utils/log"
 )
 
 type unshallowFetchOptions struct {
@@ -17,18 +17,43 @@ type unshallowFetchOptions struct {
 	// Sets '--no-recurse-submodules' flag
 	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---no-recurse-submodules
 	fetchSubmodules bool
+	// Sets `--filter=<filter-spec>` flag, the same filter the initial fetch used
+	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---filterltfilter-specgt
+	filter string
+	// Sets '--progress' flag, used for the metrics and the stall detection
+	// More info: https://git-scm.com/docs/git-fetch#Documentation/git-fetch.txt---progress
+	progress bool
 }
 
 type fallbackRetry interface {
-	do(gitCmd git.Git) error
+	do(gitCmd gitRunner) error
+}
+
+// stepwiseFallbackRetry is a fallbackRetry that re-tries the failed operation between its own steps
+type stepwiseFallbackRetry interface {
+	fallbackRetry
+	doWithRetry(gitCmd gitRunner, retry func() error) error
+}
+
+// retryWithFallback runs the fallback, then re-tries the failed operation
+func retryWithFallback(gitCmd gitRunner, fallback fallbackRetry, retry func() error) error {
+	if stepwise, ok := fallback.(stepwiseFallbackRetry); ok {
+		return stepwise.doWithRetry(gitCmd, retry)
+	}
+
+	if err := fallback.do(gitCmd); err != nil {
+		return err
+	}
+
+	return retry()
 }
 
 type simpleUnshallow struct {
 	traits unshallowFetchOptions
 }
 
-func (s simpleUnshallow) do(gitCmd git.Git) error {
-	log.Infof("Fetch with unshallow...")
+func (s simpleUnshallow) do(gitCmd gitRunner) error {
+	gitCmd.log.Infof("Fetch with unshallow...")
 
 	return unshallowFetch(gitCmd, s.traits)
 }
@@ -37,8 +62,8 @@ type resetUnshallow struct {
 	traits unshallowFetchOptions
 }
 
-func (r resetUnshallow) do(gitCmd git.Git) error {
-	log.Infof("Resetting repository, then fetch with unshallow...")
+func (r resetUnshallow) do(gitCmd gitRunner) error {
+	gitCmd.log.Infof("Resetting repository, then fetch with unshallow...")
 
 	if err := resetRepo(gitCmd); err != nil {
 		return fmt.Errorf("reset repository: %v", err)
@@ -47,8 +72,93 @@ func (r resetUnshallow) do(gitCmd git.Git) error {
 	return unshallowFetch(gitCmd, r.traits)
 }
 
-func unshallowFetch(gitCmd git.Git, traits unshallowFetchOptions) error {
-	opts := []string{jobsFlag, "--unshallow"}
+const (
+	unshallowStrategyFull        = "full"
+	unshallowStrategyProgressive = "progressive"
+	defaultUnshallowMaxDepth     = 1000
+)
+
+// progressiveUnshallow deepens the history in steps (doubling the depth each time) and re-tries the failed operation
+// after each step. Only fetches the full history if the operation still fails at the maximum depth.
+type progressiveUnshallow struct {
+	traits       unshallowFetchOptions
+	initialDepth int
+	maxDepth     int
+	// Resets the repository before each retry, as a failed merge can leave the working tree in a conflicted state
+	reset bool
+}
+
+func (p progressiveUnshallow) do(gitCmd gitRunner) error {
+	return p.unshallow(gitCmd)
+}
+
+func (p progressiveUnshallow) unshallow(gitCmd gitRunner) error {
+	if p.reset {
+		gitCmd.log.Infof("Resetting repository, then fetch with unshallow...")
+
+		if err := resetRepo(gitCmd); err != nil {
+			return fmt.Errorf("reset repository: %v", err)
+		}
+	} else {
+		gitCmd.log.Infof("Fetch with unshallow...")
+	}
+
+	return unshallowFetch(gitCmd, p.traits)
+}
+
+func (p progressiveUnshallow) doWithRetry(gitCmd gitRunner, retry func() error) error {
+	maxDepth := p.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultUnshallowMaxDepth
+	}
+
+	depth := p.initialDepth
+	if depth < 1 {
+		depth = 1
+	}
+
+	for depth < maxDepth {
+		deepenBy := depth
+		if depth+deepenBy > maxDepth {
+			deepenBy = maxDepth - depth
+		}
+
+		if p.reset {
+			if err := resetRepo(gitCmd); err != nil {
+				return fmt.Errorf("reset repository: %v", err)
+			}
+		}
+
+		gitCmd.log.Infof("Deepening history by %d commits (to depth %d)...", deepenBy, depth+deepenBy)
+		if err := deepenFetch(gitCmd, "--deepen="+strconv.Itoa(deepenBy), p.traits); err != nil {
+			return err
+		}
+		depth += deepenBy
+
+		err := retry()
+		if err == nil {
+			return nil
+		}
+		gitCmd.log.Warnf("Retry failed at depth %d: %v", depth, err)
+	}
+
+	gitCmd.log.Warnf("Maximum depth (%d) reached", maxDepth)
+	if err := p.unshallow(gitCmd); err != nil {
+		return err
+	}
+
+	return retry()
+}
+
+func unshallowFetch(gitCmd gitRunner, traits unshallowFetchOptions) error {
+	return deepenFetch(gitCmd, "--unshallow", traits)
+}
+
+func deepenFetch(gitCmd gitRunner, deepenOpt string, traits unshallowFetchOptions) error {
+	opts := []string{jobsFlag, deepenOpt}
+	if traits.filter != "" {
+		opts = append(opts, "--filter="+traits.filter)
+	}
 	if traits.tags {
 		opts = append(opts, "--tags")
 	} else {
@@ -57,10 +167,22 @@ func unshallowFetch(gitCmd git.Git, traits unshallowFetchOptions) error {
 	if !traits.fetchSubmodules {
 		opts = append(opts, "--no-recurse-submodules")
 	}
+	if traits.progress {
+		opts = append(opts, "--progress")
+	}
 
-	if err := runner.RunWithRetry(func() *command.Model {
+	if err := gitCmd.runner.RunWithRetry(func() *command.Model {
 		return gitCmd.Fetch(opts...)
 	}); err != nil {
+		var timeoutErr commandTimeoutError
+		if errors.As(err, &timeoutErr) {
+			return newStepError(
+				timeoutErr.tag("fetch"),
+				fmt.Errorf("fetch failed: %v", err),
+				"Fetching repository has timed out",
+			)
+		}
+
 		return fmt.Errorf("fetch failed: %v", err)
 	}
 	return nil
@@ -0,0 +1,106 @@
+package gitclone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	urlRewriteFailedTag = "url_rewrite_failed"
+	urlRewriteSeparator = "=>"
+)
+
+// urlRewriteRule rewrites the URLs starting with from to start with to instead, applied as `url.<to>.insteadOf <from>`
+type urlRewriteRule struct {
+	from string
+	to   string
+}
+
+// parseURLRewriteRules parses the rewrite rules, formatted as `<from> => <to>`, for example:
+// https://github.com/ => git@github.com:
+func parseURLRewriteRules(lines []string) (urlRewriteRules, error) {
+	var rules urlRewriteRules
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		from, to, found := cutString(line, urlRewriteSeparator)
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !found || from == "" || to == "" {
+			return nil, NewParameterValidationError(fmt.Sprintf("invalid URL rewrite rule (%s): expected <from> %s <to>", line, urlRewriteSeparator))
+		}
+
+		rules = append(rules, urlRewriteRule{from: from, to: to})
+	}
+
+	return rules, nil
+}
+
+// rewriteURL returns the URL as git rewrites it: the rule with the longest matching prefix is applied
+func rewriteURL(rules urlRewriteRules, url string) string {
+	var longest *urlRewriteRule
+	for i, rule := range rules {
+		if strings.HasPrefix(url, rule.from) && (longest == nil || len(rule.from) > len(longest.from)) {
+			longest = &rules[i]
+		}
+	}
+	if longest == nil {
+		return url
+	}
+
+	return longest.to + strings.TrimPrefix(url, longest.from)
+}
+
+// urlRewriteRules are applied to every git command as `url.<to>.insteadOf <from>` config passed in the environment,
+// as the submodules are cloned without the repository's config.
+type urlRewriteRules []urlRewriteRule
+
+func (r urlRewriteRules) envs(env []string) []string {
+	var config []gitConfigEntry
+	for _, rule := range r {
+		config = append(config, gitConfigEntry{key: "url." + rule.to + ".insteadOf", value: rule.from})
+	}
+	return withGitConfig(env, config)
+}
+
+// submoduleURLs returns the URLs of the submodules by name, as declared in .gitmodules
+func submoduleURLs(gitCmd gitRunner) map[string]string {
+	urls := map[string]string{}
+	for _, submodule := range submoduleConfig(gitCmd, "url") {
+		urls[submodule.name] = submodule.value
+	}
+	return urls
+}
+
+// urlRewrites collects the effective URLs which are rewritten by the rules, formatted as `<name>: <url> => <rewritten url>`
+type urlRewrites []string
+
+func (r *urlRewrites) add(rules urlRewriteRules, name, url string, log logger) {
+	if url == "" {
+		return
+	}
+
+	rewritten := rewriteURL(rules, url)
+	if rewritten == url {
+		return
+	}
+
+	rewrite := fmt.Sprintf("%s: %s %s %s", name, Redact(url), urlRewriteSeparator, Redact(rewritten))
+	log.Printf("- %s", rewrite)
+	*r = append(*r, rewrite)
+}
+
+func (r *urlRewrites) addSubmodules(rules urlRewriteRules, urls map[string]string, log logger) {
+	var names []string
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.add(rules, "submodule "+name, urls[name], log)
+	}
+}
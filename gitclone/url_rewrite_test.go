@@ -0,0 +1,127 @@
+package gitclone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-init/step"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_parseURLRewriteRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    urlRewriteRules
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "rules",
+			lines: []string{"https://github.com/ => git@github.com:", "", "  git@gitlab.com: =>https://gitlab.com/  "},
+			want: urlRewriteRules{
+				{from: "https://github.com/", to: "git@github.com:"},
+				{from: "git@gitlab.com:", to: "https://gitlab.com/"},
+			},
+		},
+		{
+			name:    "missing separator",
+			lines:   []string{"https://github.com/ git@github.com:"},
+			wantErr: true,
+		},
+		{
+			name:    "missing target",
+			lines:   []string{"https://github.com/ =>"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseURLRewriteRules(tt.lines)
+			if tt.wantErr {
+				assert.IsType(t, ParameterValidationError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_rewriteURL(t *testing.T) {
+	rules := urlRewriteRules{
+		{from: "https://github.com/", to: "git@github.com:"},
+		{from: "https://github.com/bitrise-io/", to: "ssh://git@github.example.com/bitrise-io/"},
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://github.com/bitrise-steplib/steps-git-clone.git", want: "git@github.com:bitrise-steplib/steps-git-clone.git"},
+		{url: "https://github.com/bitrise-io/go-utils.git", want: "ssh://git@github.example.com/bitrise-io/go-utils.git"},
+		{url: "git@gitlab.com:bitrise-io/go-utils.git", want: "git@gitlab.com:bitrise-io/go-utils.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.want, rewriteURL(rules, tt.url))
+		})
+	}
+}
+
+func Test_urlRewriteRules_envs(t *testing.T) {
+	rules := urlRewriteRules{{from: "https://github.com/", to: "git@github.com:"}}
+	credentials := gitCredentials{http: []httpCredentials{{username: "user", token: "token", scope: "https://gitlab.com"}}}
+
+	env := credentials.envs(rules.envs([]string{"HOME=/home/user"}))
+
+	assert.Equal(t, []string{
+		"HOME=/home/user",
+		"GIT_CONFIG_KEY_0=url.git@github.com:.insteadOf",
+		"GIT_CONFIG_VALUE_0=https://github.com/",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_1=credential.https://gitlab.com.helper",
+		"GIT_CONFIG_VALUE_1=",
+		"GIT_CONFIG_KEY_2=credential.https://gitlab.com.helper",
+		"GIT_CONFIG_VALUE_2=" + credentialHelper(0),
+		"GIT_CONFIG_COUNT=3",
+		"GIT_CLONE_HTTP_USERNAME_0=user",
+		"GIT_CLONE_HTTP_TOKEN_0=token",
+	}, env)
+}
+
+func Test_urlRewrites(t *testing.T) {
+	// Given
+	mockRunner := new(MockRunner)
+	mockRunner.On("RunForOutput", mock.Anything).
+		Return("submodule.libs/ui.url https://github.com/bitrise-io/ui.git\nsubmodule.libs/core.url git@github.com:bitrise-io/core.git\nsubmodule.libs/my lib.url https://github.com/bitrise-io/my-lib.git", nil)
+	rules := urlRewriteRules{{from: "https://github.com/", to: "git@github.com:"}}
+
+	// When
+	var rewrites urlRewrites
+	rewrites.add(rules, "repository", "https://github.com/bitrise-io/git-clone.git", logger{})
+	rewrites.add(rules, "pull request repository", "", logger{})
+	rewrites.addSubmodules(rules, submoduleURLs(gitRunner{runner: mockRunner}), logger{})
+
+	// Then
+	assert.Equal(t, urlRewrites{
+		"repository: https://github.com/bitrise-io/git-clone.git => git@github.com:bitrise-io/git-clone.git",
+		"submodule libs/my lib: https://github.com/bitrise-io/my-lib.git => git@github.com:bitrise-io/my-lib.git",
+		"submodule libs/ui: https://github.com/bitrise-io/ui.git => git@github.com:bitrise-io/ui.git",
+	}, rewrites)
+}
+
+func Test_withURLRewriteRecommendations(t *testing.T) {
+	rewrites := []string{"repository: https://github.com/bitrise-io/git-clone.git => git@github.com:bitrise-io/git-clone.git"}
+	err := withURLRewriteRecommendations(newStepError("add_remote_failed", errors.New("failed"), "Adding remote repository failed"), rewrites)
+
+	var stepErr *step.Error
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, rewrites, stepErr.Recommendations[urlRewritesRecKey])
+
+	plainErr := errors.New("failed")
+	assert.Equal(t, plainErr, withURLRewriteRecommendations(plainErr, rewrites))
+}
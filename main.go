@@ -13,15 +13,33 @@ func failf(format string, v ...interface{}) {
 	os.Exit(1)
 }
 
+// run prints the configuration and checks out the repository
+func run(cfg gitclone.Config) error {
+	printableCfg := cfg
+	printableCfg.RepositoryURL = gitclone.Redact(cfg.RepositoryURL)
+	printableCfg.PRSourceRepositoryURL = gitclone.Redact(cfg.PRSourceRepositoryURL)
+	printableCfg.BuildURL = gitclone.Redact(cfg.BuildURL)
+	stepconf.Print(printableCfg)
+
+	if err := gitclone.Execute(cfg); err != nil {
+		log.Errorf("ERROR: %v", err)
+		return err
+	}
+	log.Donef("\nSuccess")
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
 	var cfg gitclone.Config
 	if err := stepconf.Parse(&cfg); err != nil {
 		failf("Error: %s\n", err)
 	}
-	stepconf.Print(cfg)
 
-	if err := gitclone.Execute(cfg); err != nil {
-		failf("ERROR: %v", err)
+	if err := run(cfg); err != nil {
+		os.Exit(1)
 	}
-	log.Donef("\nSuccess")
 }